@@ -6,6 +6,7 @@ import (
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/handlers"
 	"github.com/FelippeTN/Web-Catalogo/backend/middleware"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,10 @@ import (
 
 func main() {
 	database.ConnectDatabase()
+	storage.Configure()
+	handlers.FailInterruptedImports()
+	handlers.StartTrashPurger()
+	handlers.StartRenditionBackfill()
 
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
@@ -38,7 +43,9 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
-	r.Static("/uploads", "./uploads")
+	if local, ok := storage.Uploads.(*storage.Local); ok {
+		r.Static(local.BaseURL, local.Dir)
+	}
 
 	publicRoutes := r.Group("/public")
 	{
@@ -50,6 +57,10 @@ func main() {
 		publicRoutes.GET("/products", handlers.GetProducts)
 		publicRoutes.GET("/collections", handlers.GetPublicCollections)
 		publicRoutes.GET("/catalogs/:token", handlers.GetPublicCatalogByToken)
+		publicRoutes.GET("/catalogs/:token/search", handlers.SearchPublicCatalog)
+		publicRoutes.POST("/catalogs/:token/quote", handlers.QuoteCatalogOrder)
+		publicRoutes.POST("/catalogs/:token/products/:id/price", handlers.PriceCatalogProduct)
+		publicRoutes.GET("/catalogs/:token/products/:id/suggestions", handlers.GetCatalogSuggestions)
 		publicRoutes.GET("/plans", handlers.GetPlans)
 	}
 
@@ -67,11 +78,48 @@ func main() {
 		protectedRoutes.PUT("/collections/:id", handlers.UpdateCollection)
 		protectedRoutes.DELETE("/collections/:id", handlers.DeleteCollection)
 		protectedRoutes.POST("/collections/:id/share", handlers.ShareCollection)
+		protectedRoutes.POST("/collections/:id/clone", handlers.CloneCollection)
+		protectedRoutes.GET("/collections/:id/revisions", handlers.GetCollectionRevisions)
+		protectedRoutes.GET("/collections/:id/order", handlers.GetCollectionOrder)
+		protectedRoutes.PUT("/collections/:id/order", handlers.ReorderCollection)
+		protectedRoutes.DELETE("/collections/:id/order", handlers.ResetCollectionOrder)
+		protectedRoutes.PUT("/collections/:id/products/:product_id/pin", handlers.PinCollectionProduct)
+		protectedRoutes.GET("/collections/:id/attributes", handlers.GetAttributeSchema)
+		protectedRoutes.PUT("/collections/:id/attributes", handlers.UpdateAttributeSchema)
 
 		protectedRoutes.POST("/products", handlers.CreateProduct)
 		protectedRoutes.GET("/products", handlers.GetMyProducts)
+		protectedRoutes.GET("/products/search", handlers.SearchMyProducts)
+		protectedRoutes.GET("/products/export", handlers.ExportProducts)
+		protectedRoutes.POST("/products/bulk", handlers.BulkUpdateProducts)
 		protectedRoutes.PUT("/products/:id", handlers.UpdateProduct)
 		protectedRoutes.DELETE("/products/:id", handlers.DeleteProduct)
+		protectedRoutes.POST("/products/:id/clone", handlers.CloneProduct)
+		protectedRoutes.POST("/products/:id/stock", handlers.AdjustProductStock)
+		protectedRoutes.GET("/products/:id/stock-movements", handlers.GetStockMovements)
+		protectedRoutes.GET("/products/:id/revisions", handlers.GetProductRevisions)
+		protectedRoutes.GET("/products/:id/related", handlers.GetRelatedProducts)
+		protectedRoutes.PUT("/products/:id/related", handlers.UpdateRelatedProducts)
+		protectedRoutes.PUT("/products/:id/images/order", handlers.ReorderProductImages)
+		protectedRoutes.PUT("/products/:id/images/:image_id", handlers.UpdateProductImage)
+		protectedRoutes.PUT("/products/:id/images/:image_id/file", handlers.ReplaceProductImage)
+		protectedRoutes.PUT("/products/:id/images/:image_id/cover", handlers.SetCoverImage)
+		protectedRoutes.POST("/products/:id/revisions/:revision_id/restore", handlers.RestoreProductRevision)
+
+		protectedRoutes.POST("/imports", handlers.UploadImport)
+		protectedRoutes.GET("/imports", handlers.GetMyImportJobs)
+		protectedRoutes.GET("/imports/:id", handlers.GetImportJob)
+		protectedRoutes.POST("/imports/:id/run", handlers.RunImport)
+
+		protectedRoutes.GET("/trash", handlers.GetTrash)
+		protectedRoutes.POST("/trash/products/:id/restore", handlers.RestoreProduct)
+		protectedRoutes.DELETE("/trash/products/:id", handlers.PurgeProduct)
+		protectedRoutes.POST("/trash/collections/:id/restore", handlers.RestoreCollection)
+		protectedRoutes.DELETE("/trash/collections/:id", handlers.PurgeCollection)
+
+		protectedRoutes.GET("/tags", handlers.GetMyTags)
+		protectedRoutes.GET("/notifications", handlers.GetMyNotifications)
+		protectedRoutes.PUT("/notifications/:id/read", handlers.MarkNotificationRead)
 		protectedRoutes.POST("/create-payment-intent", handlers.CreatePaymentIntent)
 	}
 
@@ -0,0 +1,191 @@
+// Command migrate-storage moves uploaded images from the local uploads
+// directory to the storage chosen by STORAGE_DRIVER, such as an S3 bucket,
+// and rewrites the stored image URLs to point at it. Images already moved
+// are skipped, so it can be run again after a failure.
+//
+//	STORAGE_DRIVER=s3 S3_ENDPOINT=http://localhost:9000 S3_BUCKET=uploads \
+//	S3_ACCESS_KEY_ID=... S3_SECRET_ACCESS_KEY=... go run ./cmd/migrate-storage
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"gorm.io/gorm"
+)
+
+const batchSize = 100
+
+type migration struct {
+	ctx    context.Context
+	source *storage.Local
+	target storage.Storage
+	delete bool
+	moved  int
+	failed int
+}
+
+func main() {
+	dir := flag.String("dir", "uploads", "local uploads directory to move files from")
+	deleteLocal := flag.Bool("delete", false, "remove local files once they are moved")
+	flag.Parse()
+
+	target, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := target.(*storage.Local); ok {
+		log.Fatal("STORAGE_DRIVER must name the storage to move files to, such as s3")
+	}
+	source, err := storage.NewLocal(*dir, "/uploads")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database.ConnectDatabase()
+
+	m := &migration{ctx: context.Background(), source: source, target: target, delete: *deleteLocal}
+	if err := m.migrateImages(); err != nil {
+		log.Fatal(err)
+	}
+	if err := m.migrateProductCovers(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("moved %d files, %d failed", m.moved, m.failed)
+}
+
+func (m *migration) isLocal(url string) bool {
+	return strings.HasPrefix(url, m.source.BaseURL+"/")
+}
+
+// move copies one file to the target storage and returns its new URL.
+func (m *migration) move(url string) (string, error) {
+	key := storage.Key(url)
+	body, err := m.source.Get(m.ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if err := m.target.Put(m.ctx, key, body, storage.ContentType(key)); err != nil {
+		return "", err
+	}
+	return m.target.URL(key), nil
+}
+
+func (m *migration) removeLocal(urls []string) {
+	if !m.delete {
+		return
+	}
+	for _, url := range urls {
+		if err := m.source.Delete(m.ctx, storage.Key(url)); err != nil {
+			log.Printf("could not remove %s: %v", url, err)
+		}
+	}
+}
+
+// migrateImages moves every product image with its renditions. Products
+// whose cover is the image follow it, trashed ones included.
+func (m *migration) migrateImages() error {
+	var lastID uint
+	for {
+		var images []models.ProductImage
+		if err := database.DB.Where("image_url LIKE ? AND id > ?", m.source.BaseURL+"/%", lastID).
+			Order("id asc").
+			Limit(batchSize).
+			Find(&images).Error; err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			return nil
+		}
+
+		for i := range images {
+			image := &images[i]
+			lastID = image.ID
+			previousURL := image.ImageURL
+
+			url, err := m.move(image.ImageURL)
+			if err != nil {
+				log.Printf("image %d: %s: %v", image.ID, image.ImageURL, err)
+				m.failed++
+				continue
+			}
+			moved := []string{previousURL}
+			image.ImageURL = url
+			var renditionErr error
+			for j := range image.Renditions {
+				rendition := &image.Renditions[j]
+				if !m.isLocal(rendition.URL) {
+					continue
+				}
+				renditionURL, err := m.move(rendition.URL)
+				if err != nil {
+					renditionErr = err
+					break
+				}
+				moved = append(moved, rendition.URL)
+				rendition.URL = renditionURL
+			}
+			if renditionErr != nil {
+				log.Printf("image %d: renditions: %v", image.ID, renditionErr)
+				m.failed++
+				continue
+			}
+
+			err = database.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(image).Select("image_url", "renditions").Updates(image).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Model(&models.Product{}).Where("image_url = ?", previousURL).Update("image_url", url).Error
+			})
+			if err != nil {
+				log.Printf("image %d: %v", image.ID, err)
+				m.failed++
+				continue
+			}
+			m.moved += len(moved)
+			m.removeLocal(moved)
+		}
+	}
+}
+
+// migrateProductCovers moves covers that no product image refers to, which
+// products from before multiple images may still have.
+func (m *migration) migrateProductCovers() error {
+	var lastID uint
+	for {
+		var products []models.Product
+		if err := database.DB.Unscoped().
+			Select("id", "image_url").
+			Where("image_url LIKE ? AND id > ?", m.source.BaseURL+"/%", lastID).
+			Order("id asc").
+			Limit(batchSize).
+			Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+
+		for _, product := range products {
+			lastID = product.ID
+			url, err := m.move(*product.ImageURL)
+			if err != nil {
+				log.Printf("product %d: %s: %v", product.ID, *product.ImageURL, err)
+				m.failed++
+				continue
+			}
+			if err := database.DB.Unscoped().Model(&models.Product{}).Where("id = ?", product.ID).Update("image_url", url).Error; err != nil {
+				log.Printf("product %d: %v", product.ID, err)
+				m.failed++
+				continue
+			}
+			m.moved++
+			m.removeLocal([]string{*product.ImageURL})
+		}
+	}
+}
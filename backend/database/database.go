@@ -67,15 +67,192 @@ func ConnectDatabase() {
 	err = database.AutoMigrate(
 		&models.Collection{},
 		&models.Product{},
+		&models.ProductCollection{},
+		&models.Tag{},
 		&models.ProductImage{},
+		&models.ProductOption{},
+		&models.ProductVariant{},
+		&models.ProductAttribute{},
+		&models.AttributeDefinition{},
+		&models.PriceTier{},
+		&models.BundleItem{},
+		&models.ModifierGroup{},
+		&models.ModifierOption{},
+		&models.RelatedProduct{},
+		&models.ProductAffinity{},
+		&models.QuotedCart{},
+		&models.StockMovement{},
+		&models.Notification{},
+		&models.ImportJob{},
+		&models.Revision{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database!", err)
 	}
 
+	// SKUs only need to be unique among products outside the trash.
+	if database.Migrator().HasIndex(&models.Product{}, "idx_products_owner_sku") {
+		if err := database.Migrator().DropIndex(&models.Product{}, "idx_products_owner_sku"); err != nil {
+			log.Fatal("Failed to drop old SKU index!", err)
+		}
+	}
+
+	if err := migrateProductCollections(database); err != nil {
+		log.Fatal("Failed to migrate product collections!", err)
+	}
+
+	if err := migrateTagNames(database); err != nil {
+		log.Fatal("Failed to migrate tag names!", err)
+	}
+
+	if err := migrateVariantSKUs(database); err != nil {
+		log.Fatal("Failed to migrate variant SKUs!", err)
+	}
+
+	if err := setupProductSearch(database); err != nil {
+		log.Fatal("Failed to set up product search!", err)
+	}
+
 	DB = database
 }
 
+// migrateProductCollections moves the old single products.collection_id into
+// product_collections and drops the column. Links to collections that no
+// longer exist are left out.
+func migrateProductCollections(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("products", "collection_id") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO product_collections (product_id, collection_id, created_at)
+			SELECT products.id, products.collection_id, products.created_at
+			FROM products
+			JOIN collections ON collections.id = products.collection_id
+			ON CONFLICT DO NOTHING`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`ALTER TABLE products DROP COLUMN collection_id`).Error
+	})
+}
+
+// migrateTagNames replaces the case-sensitive unique index on tag names with
+// one on LOWER(name). Tags that only differ in case are merged into the
+// oldest one first, keeping all of their products.
+func migrateTagNames(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&models.Tag{}, "idx_tags_owner_lower_name") {
+		return nil
+	}
+
+	duplicates := `SELECT id, keeper FROM (
+		SELECT id, MIN(id) OVER (PARTITION BY owner_id, LOWER(name)) AS keeper FROM tags
+	) grouped WHERE id <> keeper`
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`DROP INDEX IF EXISTS idx_tags_owner_name`,
+			`INSERT INTO product_tags (product_id, tag_id)
+			SELECT product_tags.product_id, duplicates.keeper
+			FROM product_tags JOIN (` + duplicates + `) duplicates ON duplicates.id = product_tags.tag_id
+			ON CONFLICT DO NOTHING`,
+			`DELETE FROM product_tags WHERE tag_id IN (SELECT id FROM (` + duplicates + `) duplicates)`,
+			`DELETE FROM tags WHERE id IN (SELECT id FROM (` + duplicates + `) duplicates)`,
+			`CREATE UNIQUE INDEX idx_tags_owner_lower_name ON tags (owner_id, LOWER(name))`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateVariantSKUs backs the variant SKU check with a unique index. Like
+// product SKUs, variant SKUs only need to be unique among products outside
+// the trash, so variants carry the owner and the trash time of their product,
+// kept in step by triggers. SKUs that earlier races left on more than one
+// variant stay on the oldest one.
+func migrateVariantSKUs(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE product_variants ADD COLUMN IF NOT EXISTS owner_id bigint`,
+		`ALTER TABLE product_variants ADD COLUMN IF NOT EXISTS product_deleted_at timestamptz`,
+		`CREATE OR REPLACE FUNCTION product_variants_copy_product() RETURNS trigger AS $$
+		BEGIN
+			SELECT owner_id, deleted_at INTO NEW.owner_id, NEW.product_deleted_at FROM products WHERE id = NEW.product_id;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`CREATE OR REPLACE TRIGGER product_variants_copy_product
+			BEFORE INSERT OR UPDATE OF product_id ON product_variants
+			FOR EACH ROW EXECUTE FUNCTION product_variants_copy_product()`,
+		`CREATE OR REPLACE FUNCTION products_copy_deleted_at() RETURNS trigger AS $$
+		BEGIN
+			UPDATE product_variants SET product_deleted_at = NEW.deleted_at WHERE product_id = NEW.id;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql`,
+		`CREATE OR REPLACE TRIGGER products_copy_deleted_at
+			AFTER UPDATE OF deleted_at ON products
+			FOR EACH ROW WHEN (OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+			EXECUTE FUNCTION products_copy_deleted_at()`,
+		`UPDATE product_variants SET owner_id = products.owner_id, product_deleted_at = products.deleted_at
+			FROM products
+			WHERE products.id = product_variants.product_id
+			AND (product_variants.owner_id IS DISTINCT FROM products.owner_id OR product_variants.product_deleted_at IS DISTINCT FROM products.deleted_at)`,
+		`UPDATE product_variants SET sku = NULL WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY owner_id, sku ORDER BY id) AS position
+				FROM product_variants WHERE sku IS NOT NULL AND product_deleted_at IS NULL
+			) ranked WHERE position > 1
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_owner_sku_live ON product_variants (owner_id, sku)
+			WHERE sku IS NOT NULL AND product_deleted_at IS NULL`,
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setupProductSearch keeps products.search_vector as a generated column, so
+// Postgres refreshes it on every insert and update of name or description.
+// The portuguese_unaccent configuration stems Portuguese words and folds
+// accents, so "calcados" matches "Calçados".
+func setupProductSearch(db *gorm.DB) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS unaccent`,
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'portuguese_unaccent') THEN
+				CREATE TEXT SEARCH CONFIGURATION portuguese_unaccent (COPY = portuguese);
+				ALTER TEXT SEARCH CONFIGURATION portuguese_unaccent
+					ALTER MAPPING FOR hword, hword_part, word WITH unaccent, portuguese_stem;
+			END IF;
+		END
+		$$`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('portuguese_unaccent', coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('portuguese_unaccent', coalesce(description, '')), 'B')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func seedPlans(db *gorm.DB) {
 	validNames := make([]string, len(models.DefaultPlans))
 	for i, plan := range models.DefaultPlans {
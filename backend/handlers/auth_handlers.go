@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
@@ -182,6 +183,7 @@ func UpdateMe(c *gin.Context) {
 		Username string `json:"username"`
 		Email    string `json:"email"`
 		Number   string `json:"number"`
+		Timezone string `json:"timezone"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -195,6 +197,13 @@ func UpdateMe(c *gin.Context) {
 	if input.Number != "" {
 		user.Number = input.Number
 	}
+	if input.Timezone != "" {
+		if _, err := time.LoadLocation(input.Timezone); err != nil || input.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Fuso horário inválido"})
+			return
+		}
+		user.Timezone = input.Timezone
+	}
 
 	if err := database.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao atualizar dados. Verifique se o email ou nome já estão em uso."})
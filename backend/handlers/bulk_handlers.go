@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxBulkProducts = 1000
+
+var (
+	// errBulkPreview and errBulkItemFailed roll the bulk transaction back
+	// after the report has been built.
+	errBulkPreview    = errors.New("bulk preview")
+	errBulkItemFailed = errors.New("bulk item failed")
+)
+
+type bulkItemResult struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name,omitempty"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	Before    any    `json:"before,omitempty"`
+	After     any    `json:"after,omitempty"`
+}
+
+type bulkReport struct {
+	Operation string           `json:"operation"`
+	Preview   bool             `json:"preview"`
+	Applied   bool             `json:"applied"`
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []bulkItemResult `json:"results"`
+}
+
+// BulkUpdateProducts applies one operation to a selection of products in a
+// single transaction. If any product fails, nothing is saved and the report
+// says which ones failed and why.
+func BulkUpdateProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.BulkProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if err := validateBulkInput(&input); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+
+	selection, err := bulkSelection(ownerID, &input)
+	if err != nil {
+		respondValidationError(c, err, "Could not update products")
+		return
+	}
+
+	report := &bulkReport{Operation: input.Operation, Preview: input.Preview, Results: []bulkItemResult{}}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		plan, err := loadOwnerPlan(tx, ownerID)
+		if err != nil {
+			return err
+		}
+
+		var products []models.Product
+		if err := selection(tx).Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "products"}}).
+			Order("products.id asc").
+			Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) > maxBulkProducts {
+			return newValidationError("At most %d products can be changed at once", maxBulkProducts)
+		}
+
+		found := make(map[uint]bool, len(products))
+		for _, product := range products {
+			found[product.ID] = true
+		}
+		for _, id := range input.IDs {
+			if !found[id] {
+				report.Results = append(report.Results, bulkItemResult{ProductID: id, Error: "Product not found"})
+			}
+		}
+
+		operation := bulkOperation{tx: tx, ownerID: ownerID, plan: plan, input: &input}
+		if input.Operation == models.BulkOperationSetStatus {
+			count, err := countProducts(tx, ownerID)
+			if err != nil {
+				return err
+			}
+			operation.productCount = int(count)
+		}
+		// Bundles are looked up once for the whole selection, so a bundle
+		// deleted together with its components does not block them.
+		if input.Operation == models.BulkOperationDelete && len(products) > 0 {
+			productIDs := make([]uint, len(products))
+			for i, product := range products {
+				productIDs[i] = product.ID
+			}
+			if operation.bundles, err = bundlesUsingEach(tx, productIDs); err != nil {
+				return err
+			}
+		}
+		if input.Operation == models.BulkOperationMoveToCollection {
+			if err := ensureOwnedCollections(tx, ownerID, []uint{*input.CollectionID}); err != nil {
+				return err
+			}
+		}
+
+		for i := range products {
+			result, err := operation.apply(&products[i])
+			if err != nil {
+				var validation *validationError
+				if !errors.As(err, &validation) {
+					return err
+				}
+				result.Error = validation.message
+			}
+			result.ProductID = products[i].ID
+			result.Name = products[i].Name
+			result.OK = result.Error == ""
+			report.Results = append(report.Results, result)
+		}
+
+		for _, result := range report.Results {
+			if result.OK {
+				report.Succeeded++
+			} else {
+				report.Failed++
+			}
+		}
+		report.Total = len(report.Results)
+
+		switch {
+		case report.Failed > 0:
+			return errBulkItemFailed
+		case input.Preview:
+			return errBulkPreview
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		report.Applied = true
+		c.JSON(http.StatusOK, report)
+	case errors.Is(err, errBulkPreview):
+		c.JSON(http.StatusOK, report)
+	case errors.Is(err, errBulkItemFailed):
+		c.JSON(http.StatusUnprocessableEntity, report)
+	default:
+		respondValidationError(c, err, "Could not update products")
+	}
+}
+
+func validateBulkInput(input *models.BulkProductInput) error {
+	if (len(input.IDs) > 0) == (input.Filter != nil) {
+		return newValidationError("Send either ids or filter")
+	}
+	if len(input.IDs) > maxBulkProducts {
+		return newValidationError("At most %d products can be changed at once", maxBulkProducts)
+	}
+	slices.Sort(input.IDs)
+	input.IDs = slices.Compact(input.IDs)
+
+	switch input.Operation {
+	case models.BulkOperationAdjustPrice:
+		if input.Price == nil {
+			return newValidationError("price is required")
+		}
+		return validatePriceAdjustment(input.Price)
+	case models.BulkOperationMoveToCollection:
+		if input.CollectionID == nil {
+			return newValidationError("collection_id is required")
+		}
+	case models.BulkOperationSetStatus:
+		if !slices.Contains(models.ProductStatuses, input.Status) {
+			return newValidationError("Invalid status")
+		}
+	case models.BulkOperationDelete:
+	default:
+		return newValidationError("Invalid operation")
+	}
+	return nil
+}
+
+// validatePriceAdjustment checks the mode and value and fills in the default
+// rounding rule.
+func validatePriceAdjustment(adjustment *models.BulkPriceAdjustment) error {
+	if adjustment.Mode != models.PriceAdjustmentPercent && adjustment.Mode != models.PriceAdjustmentFixed {
+		return newValidationError("Invalid price mode")
+	}
+	if adjustment.Mode == models.PriceAdjustmentPercent && adjustment.Value <= -100 {
+		return newValidationError("A price cannot be lowered by 100%% or more")
+	}
+	if adjustment.Rounding == "" {
+		adjustment.Rounding = models.PriceRoundingCents
+	}
+	rules := []string{models.PriceRoundingCents, models.PriceRoundingWhole, models.PriceRoundingEnds90, models.PriceRoundingEnds99}
+	if !slices.Contains(rules, adjustment.Rounding) {
+		return newValidationError("Invalid rounding")
+	}
+	return nil
+}
+
+// bulkSelection returns a scope for the selected products of the owner. A
+// filter uses the same rules as the product listing.
+func bulkSelection(ownerID uint, input *models.BulkProductInput) (func(tx *gorm.DB) *gorm.DB, error) {
+	if len(input.IDs) > 0 {
+		return func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("products.owner_id = ? AND products.id IN ?", ownerID, input.IDs)
+		}, nil
+	}
+
+	filter := input.Filter
+	if filter.Status != "" && !slices.Contains(models.ProductStatuses, filter.Status) {
+		return nil, newValidationError("Invalid status")
+	}
+	params := &productListParams{
+		CollectionID:  filter.CollectionID,
+		Uncategorized: filter.Uncategorized,
+		Tags:          filter.Tags,
+		Status:        filter.Status,
+		MinPrice:      filter.MinPrice,
+		MaxPrice:      filter.MaxPrice,
+		HasImages:     filter.HasImages,
+	}
+	return func(tx *gorm.DB) *gorm.DB {
+		return params.applyFilters(tx.Where("products.owner_id = ?", ownerID))
+	}, nil
+}
+
+type bulkOperation struct {
+	tx           *gorm.DB
+	ownerID      uint
+	plan         *models.Plan
+	input        *models.BulkProductInput
+	productCount int
+	// bundles lists, for deletes, the live bundles outside the selection
+	// that contain each selected product.
+	bundles map[uint][]bundleRef
+}
+
+// apply runs the operation on one product. Changes other than deletion are
+// recorded as a revision, like an edit through the product form.
+func (op *bulkOperation) apply(product *models.Product) (bulkItemResult, error) {
+	if op.input.Operation == models.BulkOperationDelete {
+		return op.delete(product)
+	}
+
+	before, err := productSnapshot(op.tx, product.ID)
+	if err != nil {
+		return bulkItemResult{}, err
+	}
+	var result bulkItemResult
+	switch op.input.Operation {
+	case models.BulkOperationAdjustPrice:
+		result, err = op.adjustPrice(product)
+	case models.BulkOperationMoveToCollection:
+		result, err = op.moveToCollection(product)
+	default:
+		result, err = op.setStatus(product)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	after, err := productSnapshot(op.tx, product.ID)
+	if err != nil {
+		return result, err
+	}
+	revision := models.Revision{OwnerID: op.ownerID, UserID: op.ownerID, EntityType: models.RevisionEntityProduct, EntityID: product.ID}
+	return result, recordRevision(op.tx, revision, before, after)
+}
+
+func (op *bulkOperation) adjustPrice(product *models.Product) (bulkItemResult, error) {
+	adjustment := op.input.Price
+	result := bulkItemResult{Before: product.Price}
+
+	newPrice := adjustedPrice(product.Price, adjustment)
+	if newPrice <= 0 {
+		return result, newValidationError("The new price would be zero or less")
+	}
+	priced := *product
+	priced.Price = newPrice
+	if err := validateProductPricing(&priced); err != nil {
+		return result, err
+	}
+	result.After = newPrice
+
+	if err := op.tx.Model(product).Update("price", newPrice).Error; err != nil {
+		return result, err
+	}
+
+	var variants []models.ProductVariant
+	if err := op.tx.Where("product_id = ? AND price IS NOT NULL", product.ID).Find(&variants).Error; err != nil {
+		return result, err
+	}
+	for _, variant := range variants {
+		variantPrice := adjustedPrice(*variant.Price, adjustment)
+		if variantPrice < 0 {
+			return result, newValidationError("The price of variant %s would be negative", variantLabel(variant.Options))
+		}
+		if err := op.tx.Model(&variant).Update("price", variantPrice).Error; err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func adjustedPrice(price float64, adjustment *models.BulkPriceAdjustment) float64 {
+	if adjustment.Mode == models.PriceAdjustmentPercent {
+		price *= 1 + adjustment.Value/100
+	} else {
+		price += adjustment.Value
+	}
+
+	switch adjustment.Rounding {
+	case models.PriceRoundingWhole:
+		price = math.Round(price)
+	case models.PriceRoundingEnds90:
+		price = math.Round(price-0.90) + 0.90
+	case models.PriceRoundingEnds99:
+		price = math.Round(price-0.99) + 0.99
+	}
+	return math.Round(price*100) / 100
+}
+
+func (op *bulkOperation) moveToCollection(product *models.Product) (bulkItemResult, error) {
+	var before []uint
+	if err := op.tx.Model(&models.ProductCollection{}).Where("product_id = ?", product.ID).Order("collection_id").Pluck("collection_id", &before).Error; err != nil {
+		return bulkItemResult{}, err
+	}
+	after := []uint{*op.input.CollectionID}
+	result := bulkItemResult{Before: before, After: after}
+	if err := replaceProductCollections(op.tx, product.ID, after); err != nil {
+		return result, err
+	}
+	return result, updateProductAttributes(op.tx, product.ID, nil, false)
+}
+
+// setStatus keeps the plan quota in view: archived products are outside it,
+// so unarchiving needs room.
+func (op *bulkOperation) setStatus(product *models.Product) (bulkItemResult, error) {
+	status := op.input.Status
+	result := bulkItemResult{Before: product.Status, After: status}
+	if product.Status == status {
+		return result, nil
+	}
+
+	wasCounted := product.Status != models.ProductStatusArchived
+	counted := status != models.ProductStatusArchived
+	if counted && !wasCounted {
+		if op.plan.MaxProducts != -1 && op.productCount >= op.plan.MaxProducts {
+			return result, newValidationError("Product limit reached for plan %s", op.plan.DisplayName)
+		}
+		op.productCount++
+	}
+	if wasCounted && !counted {
+		op.productCount--
+	}
+
+	return result, op.tx.Model(product).Update("status", status).Error
+}
+
+// delete moves the product to the trash, like DeleteProduct.
+func (op *bulkOperation) delete(product *models.Product) (bulkItemResult, error) {
+	if bundles := op.bundles[product.ID]; len(bundles) > 0 {
+		conflict := &bundleConflictError{bundles: bundles}
+		return bulkItemResult{}, newValidationError("%s", conflict.Error())
+	}
+	return bulkItemResult{}, op.tx.Delete(product).Error
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxBundleItems = 20
+
+var errProductInBundles = errors.New("product is part of bundles")
+
+type bundleRef struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// bundleConflictError blocks deleting products that live bundles still use.
+type bundleConflictError struct {
+	bundles []bundleRef
+}
+
+func (e *bundleConflictError) Error() string {
+	names := make([]string, len(e.bundles))
+	for i, bundle := range e.bundles {
+		names[i] = bundle.Name
+	}
+	return "Product is part of bundles: " + strings.Join(names, ", ")
+}
+
+func respondBundleConflict(c *gin.Context, conflict *bundleConflictError) {
+	c.JSON(http.StatusConflict, gin.H{"error": "Product is part of bundles", "bundles": conflict.bundles})
+}
+
+func normalizeProductType(productType string) (string, error) {
+	switch productType {
+	case "":
+		return models.ProductTypeSimple, nil
+	case models.ProductTypeSimple, models.ProductTypeBundle:
+		return productType, nil
+	}
+	return "", newValidationError("Invalid type")
+}
+
+// withBundleItems preloads the contents of bundles with their components.
+func withBundleItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("BundleItems", orderByPosition).Preload("BundleItems.Component")
+}
+
+// withPublicBundleItems is withBundleItems for shared catalogs: components
+// are loaded with the columns that publicBundleComponents keeps and the ones
+// their availability depends on.
+func withPublicBundleItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("BundleItems", orderByPosition).Preload("BundleItems.Component", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name", "price", "image_url", "status", "publish_at", "track_stock", "stock_quantity", "allow_backorder")
+	})
+}
+
+// publicBundleComponents trims the components of bundles to their name, price
+// and image once availability has been derived, and hides the ones shared
+// catalogs do not show.
+func publicBundleComponents(products []models.Product) {
+	now := time.Now()
+	for i := range products {
+		for j := range products[i].BundleItems {
+			item := &products[i].BundleItems[j]
+			if item.Component == nil || !item.Component.PubliclyVisible(now) {
+				item.Component = nil
+				continue
+			}
+			item.Component = &models.Product{
+				ID:             item.Component.ID,
+				Name:           item.Component.Name,
+				Price:          item.Component.Price,
+				EffectivePrice: item.Component.EffectivePrice,
+				ImageURL:       item.Component.ImageURL,
+			}
+		}
+	}
+}
+
+// buildBundleItems checks the contents of a bundle: owned simple products
+// without variants, each listed once with a positive quantity.
+func buildBundleItems(tx *gorm.DB, ownerID, bundleID uint, inputs []models.BundleItemInput) ([]models.BundleItem, error) {
+	if len(inputs) == 0 {
+		return nil, newValidationError("A bundle needs at least one product")
+	}
+	if len(inputs) > maxBundleItems {
+		return nil, newValidationError("A bundle can have at most %d products", maxBundleItems)
+	}
+
+	ids := make([]uint, len(inputs))
+	for i, input := range inputs {
+		if input.ProductID == bundleID {
+			return nil, newValidationError("A bundle cannot contain itself")
+		}
+		if input.Quantity < 1 {
+			return nil, newValidationError("Bundle quantities must be at least 1")
+		}
+		if slices.Contains(ids[:i], input.ProductID) {
+			return nil, newValidationError("Product %d is listed more than once", input.ProductID)
+		}
+		ids[i] = input.ProductID
+	}
+
+	var components []models.Product
+	if err := tx.Preload("Variants").Where("id IN ? AND owner_id = ?", ids, ownerID).Find(&components).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		index := slices.IndexFunc(components, func(component models.Product) bool { return component.ID == id })
+		if index < 0 {
+			return nil, newValidationError("Product %d not found", id)
+		}
+		component := components[index]
+		if component.Type == models.ProductTypeBundle {
+			return nil, newValidationError("%q is a bundle and cannot go inside another one", component.Name)
+		}
+		if len(component.Variants) > 0 {
+			return nil, newValidationError("%q has variants and cannot go inside a bundle", component.Name)
+		}
+	}
+
+	items := make([]models.BundleItem, len(inputs))
+	for i, input := range inputs {
+		items[i] = models.BundleItem{ComponentID: input.ProductID, Quantity: input.Quantity, Position: i}
+	}
+	return items, nil
+}
+
+func replaceBundleItems(tx *gorm.DB, bundleID uint, items []models.BundleItem) error {
+	if err := tx.Where("bundle_id = ?", bundleID).Delete(&models.BundleItem{}).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].ID = 0
+		items[i].BundleID = bundleID
+		items[i].Component = nil
+		if err := tx.Create(&items[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundlesUsing lists the bundles outside the trash that contain any of the
+// products.
+func bundlesUsing(tx *gorm.DB, productIDs []uint) ([]bundleRef, error) {
+	bundles := []bundleRef{}
+	err := tx.Model(&models.Product{}).
+		Distinct("products.id", "products.name").
+		Joins("JOIN bundle_items ON bundle_items.bundle_id = products.id").
+		Where("bundle_items.component_id IN ? AND products.id NOT IN ?", productIDs, productIDs).
+		Order("products.id").
+		Scan(&bundles).Error
+	return bundles, err
+}
+
+// bundlesUsingEach is bundlesUsing for each product on its own, still leaving
+// out bundles among productIDs, so deleting a bundle together with its
+// components is allowed.
+func bundlesUsingEach(tx *gorm.DB, productIDs []uint) (map[uint][]bundleRef, error) {
+	var rows []struct {
+		ComponentID uint
+		ID          uint
+		Name        string
+	}
+	err := tx.Model(&models.Product{}).
+		Select("bundle_items.component_id", "products.id", "products.name").
+		Joins("JOIN bundle_items ON bundle_items.bundle_id = products.id").
+		Where("bundle_items.component_id IN ? AND products.id NOT IN ?", productIDs, productIDs).
+		Order("products.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	bundles := map[uint][]bundleRef{}
+	for _, row := range rows {
+		bundles[row.ComponentID] = append(bundles[row.ComponentID], bundleRef{ID: row.ID, Name: row.Name})
+	}
+	return bundles, nil
+}
+
+// ensureNotInBundles fails with a bundleConflictError when live bundles use
+// any of the products.
+func ensureNotInBundles(tx *gorm.DB, productIDs []uint) error {
+	bundles, err := bundlesUsing(tx, productIDs)
+	if err != nil {
+		return err
+	}
+	if len(bundles) > 0 {
+		return &bundleConflictError{bundles: bundles}
+	}
+	return nil
+}
+
+// bundledProductIDs returns which of the products are components of any
+// bundle, including bundles in the trash. Those cannot be purged.
+func bundledProductIDs(tx *gorm.DB, productIDs []uint) ([]uint, error) {
+	var ids []uint
+	if len(productIDs) == 0 {
+		return ids, nil
+	}
+	err := tx.Model(&models.BundleItem{}).
+		Distinct("component_id").
+		Where("component_id IN ? AND bundle_id NOT IN ?", productIDs, productIDs).
+		Pluck("component_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// productCloner copies products inside one transaction and remembers the
+// image files it wrote so they can be removed if the transaction fails.
+type productCloner struct {
+	tx          *gorm.DB
+	nameSuffix  string
+	price       *models.BulkPriceAdjustment
+	copiedFiles []string
+}
+
+func CloneProduct(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.CloneProductInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if input.Price != nil {
+		if err := validatePriceAdjustment(input.Price); err != nil {
+			respondValidationError(c, err, "Invalid data")
+			return
+		}
+	}
+
+	cloner := &productCloner{nameSuffix: models.DefaultCloneSuffix, price: input.Price}
+	if input.NameSuffix != nil {
+		cloner.nameSuffix = *input.NameSuffix
+	}
+
+	var clone *models.Product
+	var plan *models.Plan
+	var currentCount int
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		allowed, lockedPlan, count, err := CheckProductLimit(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		plan, currentCount = lockedPlan, count
+		if !allowed {
+			return errPlanLimitReached
+		}
+
+		var source models.Product
+		if err := withProductDetails(tx).Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&source).Error; err != nil {
+			return err
+		}
+
+		cloner.tx = tx
+		clone, err = cloner.clone(&source, source.CollectionIDs)
+		return err
+	})
+	if err != nil {
+		removeUploadedFiles(cloner.copiedFiles)
+		switch {
+		case errors.Is(err, errPlanLimitReached):
+			respondPlanLimit(c, "Product limit reached", plan.MaxProducts, plan, currentCount)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		default:
+			respondValidationError(c, err, "Could not clone product")
+		}
+		return
+	}
+
+	withProductDetails(database.DB).First(clone, clone.ID)
+
+	c.JSON(http.StatusCreated, clone)
+}
+
+// CloneCollection copies a collection and every product in it that is not
+// archived. The copied products belong only to the new collection.
+func CloneCollection(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.CloneCollectionInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if input.Price != nil {
+		if err := validatePriceAdjustment(input.Price); err != nil {
+			respondValidationError(c, err, "Invalid data")
+			return
+		}
+	}
+	collectionSuffix := models.DefaultCloneSuffix
+	if input.NameSuffix != nil {
+		collectionSuffix = *input.NameSuffix
+	}
+
+	cloner := &productCloner{nameSuffix: input.ProductNameSuffix, price: input.Price}
+	var clone models.Collection
+	var productCount int
+	var plan *models.Plan
+	var limit, currentCount int
+	var limitMessage string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var source models.Collection
+		if err := tx.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&source).Error; err != nil {
+			return err
+		}
+
+		allowed, lockedPlan, count, err := CheckCollectionLimit(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			plan, limit, currentCount = lockedPlan, lockedPlan.MaxCollections, count
+			limitMessage = "Collection limit reached"
+			return errPlanLimitReached
+		}
+
+		var products []models.Product
+		if err := withProductDetails(inCollection(tx.Where("products.owner_id = ?", ownerID), source.ID)).
+			Where("products.status <> ?", models.ProductStatusArchived).
+			Order("products.id asc").
+			Find(&products).Error; err != nil {
+			return err
+		}
+
+		allowed, lockedPlan, count, err = CheckProductCapacity(tx, ownerID, len(products))
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			plan, limit, currentCount = lockedPlan, lockedPlan.MaxProducts, count
+			limitMessage = "Product limit reached"
+			return errPlanLimitReached
+		}
+
+		clone = models.Collection{OwnerID: ownerID, Name: source.Name + collectionSuffix, Description: source.Description}
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+
+		cloner.tx = tx
+		for i := range products {
+			if _, err := cloner.clone(&products[i], []uint{clone.ID}); err != nil {
+				return err
+			}
+		}
+		productCount = len(products)
+		return nil
+	})
+	if err != nil {
+		removeUploadedFiles(cloner.copiedFiles)
+		switch {
+		case errors.Is(err, errPlanLimitReached):
+			respondPlanLimit(c, limitMessage, limit, plan, currentCount)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		default:
+			respondValidationError(c, err, "Could not clone collection")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"collection": clone, "products_cloned": productCount})
+}
+
+// clone copies source with its images, options, variants, attributes, tags,
+// bundle contents and modifier groups. Clones start as drafts without SKUs
+// or stock, since neither can be shared with the original.
+func (pc *productCloner) clone(source *models.Product, collectionIDs []uint) (*models.Product, error) {
+	product := models.Product{
+		OwnerID:           source.OwnerID,
+		Type:              source.Type,
+		Name:              source.Name + pc.nameSuffix,
+		Description:       source.Description,
+		Price:             source.Price,
+		Status:            models.ProductStatusDraft,
+		CompareAtPrice:    source.CompareAtPrice,
+		SalePrice:         source.SalePrice,
+		SaleStartsAt:      source.SaleStartsAt,
+		SaleEndsAt:        source.SaleEndsAt,
+		TrackStock:        source.TrackStock,
+		AllowBackorder:    source.AllowBackorder,
+		LowStockThreshold: source.LowStockThreshold,
+		SaleUnit:          source.SaleUnit,
+		MinOrderQuantity:  source.MinOrderQuantity,
+	}
+	if pc.price != nil {
+		product.Price = adjustedPrice(product.Price, pc.price)
+		product.CompareAtPrice = pc.adjustOptional(product.CompareAtPrice)
+		product.SalePrice = pc.adjustOptional(product.SalePrice)
+		if product.Price <= 0 {
+			return nil, newValidationError("The price of %q would be zero or less", source.Name)
+		}
+		if err := validateProductPricing(&product); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pc.tx.Omit(clause.Associations).Create(&product).Error; err != nil {
+		return nil, err
+	}
+	if err := replaceProductCollections(pc.tx, product.ID, collectionIDs); err != nil {
+		return nil, err
+	}
+	if len(source.Tags) > 0 {
+		if err := pc.tx.Model(&product).Association("Tags").Append(source.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	imageIDs := make(map[uint]uint, len(source.Images))
+	for _, image := range source.Images {
+		imageURL, renditions, err := pc.copyImageFile(image.ImageURL, image.Renditions)
+		if err != nil {
+			return nil, err
+		}
+		copied := models.ProductImage{ProductID: product.ID, ImageURL: imageURL, Renditions: renditions, Position: image.Position, AltText: image.AltText, Caption: image.Caption}
+		if err := pc.tx.Create(&copied).Error; err != nil {
+			return nil, err
+		}
+		imageIDs[image.ID] = copied.ID
+		if product.ImageURL == nil {
+			product.ImageURL = &copied.ImageURL
+		}
+	}
+	if product.ImageURL != nil {
+		if err := pc.tx.Model(&product).Update("image_url", *product.ImageURL).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := replaceProductAttributes(pc.tx, product.ID, slices.Clone(source.Attributes)); err != nil {
+		return nil, err
+	}
+	if err := replacePriceTiers(pc.tx, product.ID, pc.adjustTiers(source.PriceTiers)); err != nil {
+		return nil, err
+	}
+	if err := replaceBundleItems(pc.tx, product.ID, slices.Clone(source.BundleItems)); err != nil {
+		return nil, err
+	}
+	if err := replaceModifierGroups(pc.tx, product.ID, cloneModifierGroups(source.ModifierGroups)); err != nil {
+		return nil, err
+	}
+	for _, option := range source.Options {
+		option.ID = 0
+		option.ProductID = product.ID
+		if err := pc.tx.Create(&option).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, variant := range source.Variants {
+		copied := models.ProductVariant{
+			ProductID: product.ID,
+			Options:   variant.Options,
+			Price:     pc.adjustOptional(variant.Price),
+			Available: variant.Available,
+			Position:  variant.Position,
+		}
+		if variant.ImageID != nil {
+			if imageID, ok := imageIDs[*variant.ImageID]; ok {
+				copied.ImageID = &imageID
+			}
+		}
+		if err := pc.tx.Create(&copied).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &product, nil
+}
+
+func (pc *productCloner) adjustTiers(tiers []models.PriceTier) []models.PriceTier {
+	adjusted := slices.Clone(tiers)
+	if pc.price == nil {
+		return adjusted
+	}
+	for i := range adjusted {
+		adjusted[i].UnitPrice = max(adjustedPrice(adjusted[i].UnitPrice, pc.price), 0.01)
+	}
+	return adjusted
+}
+
+func (pc *productCloner) adjustOptional(price *float64) *float64 {
+	if price == nil || pc.price == nil {
+		return price
+	}
+	adjusted := max(adjustedPrice(*price, pc.price), 0)
+	return &adjusted
+}
+
+// copyImageFile duplicates an uploaded image and its renditions so the clone
+// can later be edited or deleted without touching the original's files.
+func (pc *productCloner) copyImageFile(imageURL string, renditions []models.ImageRendition) (string, []models.ImageRendition, error) {
+	key := fmt.Sprintf("%d_%d%s", time.Now().UnixNano(), len(pc.copiedFiles), filepath.Ext(imageURL))
+	if err := storage.Copy(context.Background(), storage.Uploads, storage.Key(imageURL), key); err != nil {
+		return "", nil, err
+	}
+	url := storage.Uploads.URL(key)
+	pc.copiedFiles = append(pc.copiedFiles, url)
+
+	var copied []models.ImageRendition
+	for _, rendition := range renditions {
+		renditionKey := utils.RenditionKey(key, rendition.Name, rendition.Format)
+		if err := storage.Copy(context.Background(), storage.Uploads, storage.Key(rendition.URL), renditionKey); err != nil {
+			return "", nil, err
+		}
+		rendition.URL = storage.Uploads.URL(renditionKey)
+		copied = append(copied, rendition)
+	}
+	return url, copied, nil
+}
@@ -4,11 +4,13 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func getUserIDFromContext(c *gin.Context) (uint, bool) {
@@ -53,22 +55,6 @@ func CreateCollection(c *gin.Context) {
 		return
 	}
 
-	canCreate, plan, currentCount, err := CheckCollectionLimit(ownerID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
-		return
-	}
-	if !canCreate {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":            "Collection limit reached",
-			"limit":            plan.MaxCollections,
-			"current_count":    currentCount,
-			"plan_name":        plan.DisplayName,
-			"upgrade_required": true,
-		})
-		return
-	}
-
 	var input models.CreateCollectionInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
@@ -81,7 +67,26 @@ func CreateCollection(c *gin.Context) {
 		Description: input.Description,
 	}
 
-	if err := database.DB.Create(&collection).Error; err != nil {
+	var (
+		plan         *models.Plan
+		currentCount int
+	)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		allowed, lockedPlan, count, err := CheckCollectionLimit(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		plan, currentCount = lockedPlan, count
+		if !allowed {
+			return errPlanLimitReached
+		}
+		return tx.Create(&collection).Error
+	})
+	if err != nil {
+		if errors.Is(err, errPlanLimitReached) {
+			respondPlanLimit(c, "Collection limit reached", plan.MaxCollections, plan, currentCount)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create collection"})
 		return
 	}
@@ -137,21 +142,30 @@ func UpdateCollection(c *gin.Context) {
 		return
 	}
 
-	result := database.DB.Model(&models.Collection{}).
-		Where("id = ? AND owner_id = ?", uint(id), ownerID).
-		Updates(updates)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update collection"})
-		return
-	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
-		return
-	}
-
 	var updated models.Collection
-	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&updated).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve updated collection"})
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", uint(id), ownerID).
+			First(&updated).Error; err != nil {
+			return err
+		}
+		before := collectionSnapshot(&updated)
+
+		if err := tx.Model(&updated).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&updated, updated.ID).Error; err != nil {
+			return err
+		}
+		revision := models.Revision{OwnerID: ownerID, UserID: ownerID, EntityType: models.RevisionEntityCollection, EntityID: updated.ID}
+		return recordRevision(tx, revision, before, collectionSnapshot(&updated))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update collection"})
 		return
 	}
 
@@ -179,33 +193,46 @@ func DeleteCollection(c *gin.Context) {
 			return err
 		}
 
+		// Products that also appear in another live collection stay; the rest
+		// go to the trash with the collection, stamped with the same time so
+		// that restoring the collection brings them back together. Products that
+		// live bundles contain block the deletion, as in DeleteProduct.
 		var productIDs []uint
-		if err := tx.Model(&models.Product{}).Where("owner_id = ? AND collection_id = ?", ownerID, collectionID).Pluck("id", &productIDs).Error; err != nil {
+		if err := tx.Model(&models.ProductCollection{}).
+			Joins("JOIN products ON products.id = product_collections.product_id AND products.deleted_at IS NULL").
+			Where("product_collections.collection_id = ?", collectionID).
+			Where("NOT EXISTS (SELECT 1 FROM product_collections other JOIN collections ON collections.id = other.collection_id AND collections.deleted_at IS NULL "+
+				"WHERE other.product_id = product_collections.product_id AND other.collection_id <> ?)", collectionID).
+			Pluck("product_collections.product_id", &productIDs).Error; err != nil {
 			return err
 		}
 
+		deletedAt := time.Now()
 		if len(productIDs) > 0 {
-			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductImage{}).Error; err != nil {
+			if err := ensureNotInBundles(tx, productIDs); err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Product{}).Where("owner_id = ? AND id IN ?", ownerID, productIDs).Update("deleted_at", deletedAt).Error; err != nil {
 				return err
 			}
 		}
 
-		if err := tx.Where("owner_id = ? AND collection_id = ?", ownerID, collectionID).Delete(&models.Product{}).Error; err != nil {
-			return err
-		}
-
-		if err := tx.Where("id = ? AND owner_id = ?", collectionID, ownerID).Delete(&models.Collection{}).Error; err != nil {
+		if err := tx.Model(&collection).Update("deleted_at", deletedAt).Error; err != nil {
 			return err
 		}
 
 		return nil
 	})
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		var conflict *bundleConflictError
+		switch {
+		case errors.As(err, &conflict):
+			respondBundleConflict(c, conflict)
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
-			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete collection"})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete collection"})
 		return
 	}
 
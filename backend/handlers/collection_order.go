@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const collectionOrderClause = "product_collections.pinned desc, product_collections.position asc nulls last, products.created_at desc, products.id desc"
+
+type collectionOrderItem struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name"`
+	Position  *int   `json:"position"`
+	Pinned    bool   `json:"pinned"`
+}
+
+// orderedInCollection keeps the products of a collection in the owner's
+// manual order. Products without a position follow, newest first, which is
+// the whole order of a collection that was never reordered.
+func orderedInCollection(query *gorm.DB, collectionID uint) *gorm.DB {
+	return query.
+		Joins("JOIN product_collections ON product_collections.product_id = products.id AND product_collections.collection_id = ?", collectionID).
+		Order(collectionOrderClause)
+}
+
+func collectionOrder(tx *gorm.DB, collectionID uint) ([]collectionOrderItem, error) {
+	items := []collectionOrderItem{}
+	err := orderedInCollection(tx.Model(&models.Product{}), collectionID).
+		Select("products.id AS product_id, products.name, product_collections.position, product_collections.pinned").
+		Scan(&items).Error
+	return items, err
+}
+
+func collectionRequestIDs(c *gin.Context) (uint, uint, bool) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return 0, 0, false
+	}
+	return ownerID, uint(id), true
+}
+
+// lockOwnedCollection makes concurrent changes to one collection's order apply
+// one after the other.
+func lockOwnedCollection(tx *gorm.DB, ownerID, id uint) error {
+	var collection models.Collection
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND owner_id = ?", id, ownerID).
+		First(&collection).Error
+}
+
+func respondCollectionOrder(c *gin.Context, items []collectionOrderItem, err error) {
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		respondValidationError(c, err, "Could not update collection order")
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+func GetCollectionOrder(c *gin.Context) {
+	ownerID, id, ok := collectionRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var items []collectionOrderItem
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND owner_id = ?", id, ownerID).First(&models.Collection{}).Error; err != nil {
+			return err
+		}
+		var err error
+		items, err = collectionOrder(tx, id)
+		return err
+	})
+	respondCollectionOrder(c, items, err)
+}
+
+// ReorderCollection stores a new manual order. Listed products take the
+// first positions in the order given and the others keep their relative
+// order after them; pinned products stay on top either way.
+func ReorderCollection(c *gin.Context) {
+	ownerID, id, ok := collectionRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var input models.ReorderCollectionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	var items []collectionOrderItem
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOwnedCollection(tx, ownerID, id); err != nil {
+			return err
+		}
+		current, err := collectionOrder(tx, id)
+		if err != nil {
+			return err
+		}
+
+		members := make(map[uint]bool, len(current))
+		for _, item := range current {
+			members[item.ProductID] = true
+		}
+		listed := make(map[uint]bool, len(input.ProductIDs))
+		for _, productID := range input.ProductIDs {
+			if !members[productID] {
+				return newValidationError("Product %d is not in this collection", productID)
+			}
+			if listed[productID] {
+				return newValidationError("Product %d is listed more than once", productID)
+			}
+			listed[productID] = true
+		}
+
+		order := append([]uint{}, input.ProductIDs...)
+		for _, item := range current {
+			if !listed[item.ProductID] {
+				order = append(order, item.ProductID)
+			}
+		}
+		for position, productID := range order {
+			if err := tx.Model(&models.ProductCollection{}).
+				Where("product_id = ? AND collection_id = ?", productID, id).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+
+		items, err = collectionOrder(tx, id)
+		return err
+	})
+	respondCollectionOrder(c, items, err)
+}
+
+// PinCollectionProduct pins a product to the top of the collection or
+// unpins it.
+func PinCollectionProduct(c *gin.Context) {
+	ownerID, id, ok := collectionRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+
+	var input models.PinProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	var items []collectionOrderItem
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOwnedCollection(tx, ownerID, id); err != nil {
+			return err
+		}
+		result := tx.Model(&models.ProductCollection{}).
+			Where("product_id = ? AND collection_id = ?", uint(productID), id).
+			Update("pinned", *input.Pinned)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return newValidationError("Product %d is not in this collection", productID)
+		}
+
+		items, err = collectionOrder(tx, id)
+		return err
+	})
+	respondCollectionOrder(c, items, err)
+}
+
+// ResetCollectionOrder drops positions and pins, going back to newest first.
+func ResetCollectionOrder(c *gin.Context) {
+	ownerID, id, ok := collectionRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var items []collectionOrderItem
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOwnedCollection(tx, ownerID, id); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ProductCollection{}).
+			Where("collection_id = ?", id).
+			Updates(map[string]any{"position": nil, "pinned": false}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		items, err = collectionOrder(tx, id)
+		return err
+	})
+	respondCollectionOrder(c, items, err)
+}
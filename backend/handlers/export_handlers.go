@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const exportBatchSize = 200
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// productExportColumns is the export layout. Columns are only ever appended
+// so files keep working with tools built against older exports; the headers
+// that match import fields can be fed straight back into an import.
+// Collections, tags and image URLs hold several values separated by "; " and
+// timestamps are RFC 3339 in UTC.
+var productExportColumns = []struct {
+	header string
+	value  func(product *models.Product, collectionNames map[uint]string) any
+}{
+	{"id", func(p *models.Product, _ map[uint]string) any { return p.ID }},
+	{"sku", func(p *models.Product, _ map[uint]string) any { return optionalString(p.SKU) }},
+	{"name", func(p *models.Product, _ map[uint]string) any { return p.Name }},
+	{"description", func(p *models.Product, _ map[uint]string) any { return p.Description }},
+	{"price", func(p *models.Product, _ map[uint]string) any { return p.Price }},
+	{"compare_at_price", func(p *models.Product, _ map[uint]string) any { return optionalFloat(p.CompareAtPrice) }},
+	{"status", func(p *models.Product, _ map[uint]string) any { return p.Status }},
+	{"stock_quantity", func(p *models.Product, _ map[uint]string) any {
+		if !p.TrackStock || len(p.Variants) > 0 {
+			return nil
+		}
+		return p.StockQuantity
+	}},
+	{"collections", func(p *models.Product, names map[uint]string) any {
+		values := make([]string, 0, len(p.CollectionIDs))
+		for _, id := range p.CollectionIDs {
+			values = append(values, names[id])
+		}
+		return strings.Join(values, "; ")
+	}},
+	{"tags", func(p *models.Product, _ map[uint]string) any {
+		values := make([]string, len(p.Tags))
+		for i, tag := range p.Tags {
+			values[i] = tag.Name
+		}
+		return strings.Join(values, "; ")
+	}},
+	{"image_urls", func(p *models.Product, _ map[uint]string) any {
+		values := make([]string, len(p.Images))
+		for i, image := range p.Images {
+			values[i] = image.ImageURL
+		}
+		return strings.Join(values, "; ")
+	}},
+	{"created_at", func(p *models.Product, _ map[uint]string) any { return p.CreatedAt.UTC().Format(time.RFC3339) }},
+	{"updated_at", func(p *models.Product, _ map[uint]string) any { return p.UpdatedAt.UTC().Format(time.RFC3339) }},
+}
+
+func optionalString(value *string) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func optionalFloat(value *float64) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// ExportProducts streams the owner's products, or those of one collection,
+// as CSV (default) or XLSX.
+func ExportProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	scope := database.DB.Where("products.owner_id = ?", ownerID)
+	fileName := "produtos"
+	if raw := c.Query("collection_id"); raw != "" {
+		collectionID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection_id"})
+			return
+		}
+		var collection models.Collection
+		if err := database.DB.Where("id = ? AND owner_id = ?", uint(collectionID), ownerID).First(&collection).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+			return
+		}
+		scope = inCollection(scope, collection.ID)
+		fileName = fmt.Sprintf("colecao-%d", collection.ID)
+	}
+	if status := c.Query("status"); status != "" {
+		if !slices.Contains(models.ProductStatuses, status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		scope = scope.Where("products.status = ?", status)
+	}
+
+	var collections []models.Collection
+	if err := database.DB.Where("owner_id = ?", ownerID).Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not export products"})
+		return
+	}
+	collectionNames := make(map[uint]string, len(collections))
+	for _, collection := range collections {
+		collectionNames[collection.ID] = collection.Name
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, fileName, time.Now().Format("20060102"), format))
+	c.Status(http.StatusOK)
+
+	// Once the first byte is out the status cannot change, so failures past
+	// this point only cut the download short.
+	if err := writeProductExport(c, format, scope, collectionNames); err != nil {
+		log.Printf("export for owner %d: %v", ownerID, err)
+		c.Abort()
+	}
+}
+
+func writeProductExport(c *gin.Context, format string, scope *gorm.DB, collectionNames map[uint]string) error {
+	writer, err := utils.NewSpreadsheetWriter(format, c.Writer)
+	if err != nil {
+		return err
+	}
+
+	headers := make([]any, len(productExportColumns))
+	for i, column := range productExportColumns {
+		headers[i] = column.header
+	}
+	if err := writer.WriteRow(headers); err != nil {
+		return err
+	}
+
+	var lastID uint
+	for {
+		var products []models.Product
+		err := scope.Session(&gorm.Session{}).
+			Preload("Images", orderByPosition).
+			Preload("Variants").
+			Preload("CollectionLinks", liveCollectionLinks).
+			Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("tags.name asc") }).
+			Where("products.id > ?", lastID).
+			Order("products.id asc").
+			Limit(exportBatchSize).
+			Find(&products).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range products {
+			row := make([]any, len(productExportColumns))
+			for j, column := range productExportColumns {
+				row[j] = column.value(&products[i], collectionNames)
+			}
+			if err := writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+
+		if len(products) < exportBatchSize {
+			break
+		}
+		lastID = products[len(products)-1].ID
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,959 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxImportFileSize   = 10 << 20
+	maxImportRows       = 5000
+	maxStoredRowErrors  = 1000
+	importSampleRows    = 5
+	importProgressEvery = 25
+	// importJobLock, with the job id as second key, is the advisory lock a
+	// replica holds while it runs an import.
+	importJobLock = 470034
+)
+
+// errImportDryRun rolls back the import transaction once a dry run has
+// validated every row.
+var errImportDryRun = errors.New("import dry run")
+
+// importFieldAliases lists header names recognised when suggesting a mapping,
+// already lowercased and without accents.
+var importFieldAliases = map[string][]string{
+	models.ImportFieldSKU:            {"sku", "codigo", "cod", "ref", "referencia"},
+	models.ImportFieldName:           {"name", "nome", "produto", "titulo"},
+	models.ImportFieldDescription:    {"description", "descricao", "detalhes"},
+	models.ImportFieldPrice:          {"price", "preco", "valor", "preco de venda"},
+	models.ImportFieldCompareAtPrice: {"compare_at_price", "compare at price", "preco de", "preco original", "preco antigo"},
+	models.ImportFieldStatus:         {"status", "situacao"},
+	models.ImportFieldStockQuantity:  {"stock_quantity", "stock", "estoque", "quantidade", "qtd"},
+	models.ImportFieldCollections:    {"collections", "collection", "colecoes", "colecao", "categorias", "categoria"},
+	models.ImportFieldTags:           {"tags", "tag", "etiquetas"},
+}
+
+var importStatusAliases = map[string]string{
+	"rascunho":  models.ProductStatusDraft,
+	"publicado": models.ProductStatusPublished,
+	"arquivado": models.ProductStatusArchived,
+}
+
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e",
+	"í", "i",
+	"ó", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ü", "u",
+	"ç", "c",
+)
+
+type importUploadResponse struct {
+	Job    models.ImportJob `json:"job"`
+	Sample [][]string       `json:"sample"`
+	Fields []string         `json:"fields"`
+}
+
+func UploadImport(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if file.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large"})
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".csv" && ext != ".xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only CSV and XLSX files are supported"})
+		return
+	}
+
+	data, err := readImportUpload(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save file"})
+		return
+	}
+	rows, err := utils.ReadSpreadsheet(file.Filename, data, maxImportRows+1)
+	if err == nil {
+		err = validateImportSheet(rows)
+	}
+	if err != nil {
+		respondValidationError(c, newValidationError("Could not read spreadsheet: %s", importSheetError(err)), "Could not read spreadsheet")
+		return
+	}
+
+	// The spreadsheet goes to shared storage, since the replica that runs the
+	// import may not be this one.
+	token, err := utils.GenerateShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save file"})
+		return
+	}
+	storedPath := fmt.Sprintf("import-%d-%s%s", ownerID, token, ext)
+	if err := storage.Imports.Put(c.Request.Context(), storedPath, data, storage.ContentType(storedPath)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save file"})
+		return
+	}
+
+	headers := make([]string, len(rows[0]))
+	for i, header := range rows[0] {
+		headers[i] = strings.TrimSpace(header)
+	}
+
+	job := models.ImportJob{
+		OwnerID:    ownerID,
+		FileName:   filepath.Base(file.Filename),
+		StoredPath: storedPath,
+		Status:     models.ImportStatusUploaded,
+		Headers:    headers,
+		Mapping:    suggestImportMapping(headers),
+		TotalRows:  len(rows) - 1,
+		RowErrors:  []models.ImportRowError{},
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		storage.Imports.Delete(c.Request.Context(), storedPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create import"})
+		return
+	}
+
+	sample := rows[1:min(len(rows), importSampleRows+1)]
+	c.JSON(http.StatusCreated, importUploadResponse{Job: job, Sample: sample, Fields: models.ImportFields})
+}
+
+func validateImportSheet(rows [][]string) error {
+	if len(rows) < 2 {
+		return newValidationError("the file needs a header row and at least one product")
+	}
+	if len(rows)-1 > maxImportRows {
+		return newValidationError("at most %d rows can be imported at once", maxImportRows)
+	}
+	seen := map[string]bool{}
+	for _, header := range rows[0] {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if seen[strings.ToLower(header)] {
+			return newValidationError("duplicate column %q", header)
+		}
+		seen[strings.ToLower(header)] = true
+	}
+	if len(seen) == 0 {
+		return newValidationError("the header row is empty")
+	}
+	return nil
+}
+
+func importSheetError(err error) string {
+	var validation *validationError
+	if errors.As(err, &validation) {
+		return validation.message
+	}
+	if errors.Is(err, utils.ErrTooManyRows) {
+		return fmt.Sprintf("at most %d rows can be imported at once", maxImportRows)
+	}
+	return "the file is not a valid CSV or XLSX spreadsheet"
+}
+
+func normalizeHeader(header string) string {
+	header = accentReplacer.Replace(strings.ToLower(strings.TrimSpace(header)))
+	return strings.Join(strings.Fields(strings.ReplaceAll(header, "_", " ")), " ")
+}
+
+func suggestImportMapping(headers []string) map[string]string {
+	mapping := map[string]string{}
+	for _, field := range models.ImportFields {
+		for _, header := range headers {
+			if header == "" || slices.Contains(mapValues(mapping), header) {
+				continue
+			}
+			normalized := normalizeHeader(header)
+			for _, alias := range importFieldAliases[field] {
+				if normalized == normalizeHeader(alias) {
+					mapping[field] = header
+					break
+				}
+			}
+			if _, ok := mapping[field]; ok {
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return values
+}
+
+func validateImportMapping(mapping map[string]string, headers []string) error {
+	for field, header := range mapping {
+		if !slices.Contains(models.ImportFields, field) {
+			return newValidationError("Unknown field %q", field)
+		}
+		if header != "" && !slices.Contains(headers, header) {
+			return newValidationError("Column %q not found in file", header)
+		}
+	}
+	if mapping[models.ImportFieldSKU] == "" && mapping[models.ImportFieldName] == "" {
+		return newValidationError("Map at least the sku or name column")
+	}
+	return nil
+}
+
+func findImportJob(c *gin.Context) (*models.ImportJob, bool) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return nil, false
+	}
+
+	var job models.ImportJob
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve import"})
+		return nil, false
+	}
+	return &job, true
+}
+
+func GetImportJob(c *gin.Context) {
+	job, ok := findImportJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func GetMyImportJobs(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var jobs []models.ImportJob
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("created_at desc").Limit(50).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve imports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// RunImport queues an uploaded file for a dry run or a real run. Only one
+// import per owner runs at a time.
+func RunImport(c *gin.Context) {
+	job, ok := findImportJob(c)
+	if !ok {
+		return
+	}
+
+	var input models.RunImportInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if err := validateImportMapping(input.Mapping, job.Headers); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var owner models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&owner, job.OwnerID).Error; err != nil {
+			return err
+		}
+
+		var active int64
+		if err := tx.Model(&models.ImportJob{}).
+			Where("owner_id = ? AND status IN ?", job.OwnerID, []string{models.ImportStatusQueued, models.ImportStatusRunning}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return newValidationError("Another import is already running")
+		}
+		if job.Status == models.ImportStatusCompleted && !job.DryRun {
+			return newValidationError("This file has already been imported")
+		}
+
+		job.Status = models.ImportStatusQueued
+		job.DryRun = input.DryRun
+		job.Mapping = input.Mapping
+		return tx.Model(job).Select("status", "dry_run", "mapping").Updates(job).Error
+	})
+	if err != nil {
+		var validation *validationError
+		if errors.As(err, &validation) {
+			c.JSON(http.StatusConflict, gin.H{"error": validation.message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start import"})
+		return
+	}
+
+	go runImportJob(job.ID)
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func readImportUpload(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return io.ReadAll(io.LimitReader(src, maxImportFileSize))
+}
+
+// FailInterruptedImports marks imports left queued or running by a stopped
+// process as failed; their transaction was rolled back when it stopped.
+// Imports that another replica is running hold their advisory lock and are
+// left alone.
+func FailInterruptedImports() {
+	var jobIDs []uint
+	if err := database.DB.Model(&models.ImportJob{}).
+		Where("status IN ?", []string{models.ImportStatusQueued, models.ImportStatusRunning}).
+		Pluck("id", &jobIDs).Error; err != nil {
+		log.Printf("could not mark interrupted imports as failed: %v", err)
+		return
+	}
+
+	for _, jobID := range jobIDs {
+		err := withImportJobLock(jobID, func(conn *gorm.DB) error {
+			return conn.Model(&models.ImportJob{}).
+				Where("id = ? AND status IN ?", jobID, []string{models.ImportStatusQueued, models.ImportStatusRunning}).
+				Updates(map[string]any{"status": models.ImportStatusFailed, "error": "Interrupted by a server restart", "finished_at": time.Now()}).Error
+		})
+		if err != nil {
+			log.Printf("could not mark import %d as failed: %v", jobID, err)
+		}
+	}
+}
+
+// withImportJobLock runs fn while holding the advisory lock of the job, and
+// skips it when another process holds the lock.
+func withImportJobLock(jobID uint, fn func(conn *gorm.DB) error) error {
+	return database.DB.Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?, ?)", importJobLock, jobID).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?, ?)", importJobLock, jobID)
+		return fn(conn)
+	})
+}
+
+func runImportJob(jobID uint) {
+	// A panic fails the job instead of the server; the import transaction
+	// has already been rolled back by the time it gets here.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("import %d: panic: %v\n%s", jobID, recovered, debug.Stack())
+			database.DB.Model(&models.ImportJob{}).Where("id = ?", jobID).Updates(map[string]any{
+				"status":        models.ImportStatusFailed,
+				"error":         "Import failed; no products were changed",
+				"created_count": 0,
+				"updated_count": 0,
+				"finished_at":   time.Now(),
+			})
+		}
+	}()
+
+	err := withImportJobLock(jobID, func(*gorm.DB) error {
+		executeImportJob(jobID)
+		return nil
+	})
+	if err != nil {
+		log.Printf("import %d: %v", jobID, err)
+	}
+}
+
+// executeImportJob runs a queued import. Jobs in any other state were
+// started elsewhere or failed by FailInterruptedImports before their lock
+// was taken.
+func executeImportJob(jobID uint) {
+	var job models.ImportJob
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		log.Printf("import %d: %v", jobID, err)
+		return
+	}
+	if job.Status != models.ImportStatusQueued {
+		return
+	}
+
+	startedAt := time.Now()
+	job.Status = models.ImportStatusRunning
+	job.StartedAt = &startedAt
+	job.FinishedAt = nil
+	job.ProcessedRows, job.CreatedCount, job.UpdatedCount, job.FailedCount = 0, 0, 0, 0
+	job.RowErrors = []models.ImportRowError{}
+	job.Error = ""
+	if err := database.DB.Save(&job).Error; err != nil {
+		log.Printf("import %d: %v", jobID, err)
+		return
+	}
+
+	err := importSpreadsheet(&job)
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.Status = models.ImportStatusCompleted
+	if err != nil && !errors.Is(err, errImportDryRun) {
+		log.Printf("import %d: %v", jobID, err)
+		job.Status = models.ImportStatusFailed
+		job.Error = "Import failed; no products were changed"
+		job.CreatedCount, job.UpdatedCount = 0, 0
+	}
+	if err := database.DB.Save(&job).Error; err != nil {
+		log.Printf("import %d: %v", jobID, err)
+	}
+
+	if job.Status == models.ImportStatusCompleted && !job.DryRun {
+		storage.Imports.Delete(context.Background(), job.StoredPath)
+	}
+}
+
+// importSpreadsheet applies every row inside one transaction that holds the
+// owner lock, so plan limits are checked against a stable count. Each row
+// runs under a savepoint and a failing row is reported without stopping the
+// rest. Dry runs roll the whole transaction back.
+func importSpreadsheet(job *models.ImportJob) error {
+	data, err := storage.Imports.Get(context.Background(), job.StoredPath)
+	if err != nil {
+		return err
+	}
+	rows, err := utils.ReadSpreadsheet(job.StoredPath, data, maxImportRows+1)
+	if err != nil {
+		return err
+	}
+
+	columns := map[string]int{}
+	for field, header := range job.Mapping {
+		if index := slices.Index(job.Headers, header); header != "" && index >= 0 {
+			columns[field] = index
+		}
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		importer, err := newProductImporter(tx, job, columns)
+		if err != nil {
+			return err
+		}
+
+		for i, cells := range rows[1:] {
+			rowNumber := i + 2
+			if !isBlankImportRow(cells) {
+				importer.importRow(rowNumber, cells)
+			}
+			job.ProcessedRows++
+			if job.ProcessedRows%importProgressEvery == 0 {
+				reportImportProgress(job)
+			}
+		}
+
+		if job.DryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+}
+
+func isBlankImportRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// reportImportProgress writes counters outside the import transaction so
+// they are visible while it runs.
+func reportImportProgress(job *models.ImportJob) {
+	database.DB.Model(&models.ImportJob{}).Where("id = ?", job.ID).Updates(map[string]any{
+		"processed_rows": job.ProcessedRows,
+		"created_count":  job.CreatedCount,
+		"updated_count":  job.UpdatedCount,
+		"failed_count":   job.FailedCount,
+	})
+}
+
+type productImporter struct {
+	tx              *gorm.DB
+	job             *models.ImportJob
+	columns         map[string]int
+	plan            *models.Plan
+	productCount    int
+	collectionCount int
+	collections     map[string]models.Collection
+	skuRows         map[string]int
+}
+
+func newProductImporter(tx *gorm.DB, job *models.ImportJob, columns map[string]int) (*productImporter, error) {
+	plan, err := loadOwnerPlan(tx, job.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	productCount, err := countProducts(tx, job.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	collectionCount, err := countCollections(tx, job.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var collections []models.Collection
+	if err := tx.Where("owner_id = ?", job.OwnerID).Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.Collection, len(collections))
+	for _, collection := range collections {
+		byName[strings.ToLower(collection.Name)] = collection
+	}
+
+	return &productImporter{
+		tx:              tx,
+		job:             job,
+		columns:         columns,
+		plan:            plan,
+		productCount:    int(productCount),
+		collectionCount: int(collectionCount),
+		collections:     byName,
+		skuRows:         map[string]int{},
+	}, nil
+}
+
+// cell returns the trimmed value of a mapped field, without the apostrophe
+// CSV exports put before formula-like text; ok is false when the field is
+// unmapped or the cell is empty.
+func (imp *productImporter) cell(cells []string, field string) (string, bool) {
+	index, mapped := imp.columns[field]
+	if !mapped || index >= len(cells) {
+		return "", false
+	}
+	value := cells[index]
+	if strings.EqualFold(filepath.Ext(imp.job.StoredPath), ".csv") {
+		value = utils.UnescapeFormula(value)
+	}
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
+
+func (imp *productImporter) fail(rowNumber int, field, message string) {
+	imp.job.FailedCount++
+	if len(imp.job.RowErrors) < maxStoredRowErrors {
+		imp.job.RowErrors = append(imp.job.RowErrors, models.ImportRowError{Row: rowNumber, Field: field, Message: message})
+	}
+}
+
+// importRow parses one row, then creates or updates the product under a
+// savepoint. Parse problems are all reported together.
+func (imp *productImporter) importRow(rowNumber int, cells []string) {
+	row, rowErrors := imp.parseRow(rowNumber, cells)
+	if len(rowErrors) > 0 {
+		imp.job.FailedCount++
+		for _, rowError := range rowErrors {
+			if len(imp.job.RowErrors) < maxStoredRowErrors {
+				imp.job.RowErrors = append(imp.job.RowErrors, rowError)
+			}
+		}
+		return
+	}
+
+	if err := imp.tx.SavePoint("import_row").Error; err != nil {
+		imp.fail(rowNumber, "", "Could not import row")
+		return
+	}
+
+	created, newCollections, err := imp.saveRow(row)
+	if err != nil {
+		imp.tx.RollbackTo("import_row")
+		var validation *validationError
+		if errors.As(err, &validation) {
+			imp.fail(rowNumber, row.errorField, validation.message)
+		} else {
+			log.Printf("import %d row %d: %v", imp.job.ID, rowNumber, err)
+			imp.fail(rowNumber, "", "Could not import row")
+		}
+		return
+	}
+
+	for _, collection := range newCollections {
+		imp.collections[strings.ToLower(collection.Name)] = collection
+		imp.collectionCount++
+	}
+	if row.sku != nil {
+		imp.skuRows[*row.sku] = rowNumber
+	}
+	if created {
+		imp.job.CreatedCount++
+	} else {
+		imp.job.UpdatedCount++
+	}
+}
+
+type importRow struct {
+	number          int
+	sku             *string
+	name            *string
+	description     *string
+	price           *float64
+	compareAtPrice  *float64
+	status          *string
+	stockQuantity   *int
+	collectionNames []string
+	tags            []string
+	hasTags         bool
+	errorField      string
+}
+
+func (imp *productImporter) parseRow(rowNumber int, cells []string) (*importRow, []models.ImportRowError) {
+	row := &importRow{number: rowNumber}
+	var rowErrors []models.ImportRowError
+	fail := func(field, format string, args ...any) {
+		rowErrors = append(rowErrors, models.ImportRowError{Row: rowNumber, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value, ok := imp.cell(cells, models.ImportFieldSKU); ok {
+		row.sku = normalizeSKU(&value)
+		if previous, seen := imp.skuRows[*row.sku]; seen {
+			fail(models.ImportFieldSKU, "SKU %q already used in row %d", *row.sku, previous)
+		}
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldName); ok {
+		row.name = &value
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldDescription); ok {
+		row.description = &value
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldPrice); ok {
+		price, err := parseImportDecimal(value)
+		if err != nil || price <= 0 {
+			fail(models.ImportFieldPrice, "Invalid price %q", value)
+		} else {
+			row.price = &price
+		}
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldCompareAtPrice); ok {
+		price, err := parseImportDecimal(value)
+		if err != nil || price <= 0 {
+			fail(models.ImportFieldCompareAtPrice, "Invalid compare_at_price %q", value)
+		} else {
+			row.compareAtPrice = &price
+		}
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldStatus); ok {
+		if alias, found := importStatusAliases[strings.ToLower(value)]; found {
+			value = alias
+		}
+		status, err := normalizeProductStatus(value)
+		if err != nil {
+			fail(models.ImportFieldStatus, "Invalid status %q", value)
+		} else {
+			row.status = &status
+		}
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldStockQuantity); ok {
+		quantity, err := parseImportDecimal(value)
+		if err != nil || quantity < 0 || quantity != math.Trunc(quantity) {
+			fail(models.ImportFieldStockQuantity, "Invalid stock_quantity %q", value)
+		} else {
+			stock := int(quantity)
+			row.stockQuantity = &stock
+		}
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldCollections); ok {
+		row.collectionNames = splitImportList(value)
+	}
+	if value, ok := imp.cell(cells, models.ImportFieldTags); ok {
+		tags, err := normalizeTagNames(splitImportList(value))
+		if err != nil {
+			fail(models.ImportFieldTags, "%s", err.Error())
+		} else {
+			row.tags = tags
+			row.hasTags = true
+		}
+	}
+
+	return row, rowErrors
+}
+
+func splitImportList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ";") {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseImportDecimal reads numbers the way Brazilian spreadsheets write them:
+// "79,90", "1.234,56" and "1.234" (one thousand two hundred thirty-four).
+// "79.90" and "R$ 1,234.56" are accepted too. When both separators appear the
+// right-most one is the decimal point; a lone dot is a thousands separator
+// only when it splits the number into groups of three digits.
+func parseImportDecimal(raw string) (float64, error) {
+	value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(raw), "R$"))
+	value = strings.ReplaceAll(value, " ", "")
+
+	whole, fraction, grouping := value, "", ""
+	hasDot, hasComma := strings.Contains(value, "."), strings.Contains(value, ",")
+	switch {
+	case hasDot && hasComma:
+		decimal := strings.LastIndexAny(value, ".,")
+		whole, fraction = value[:decimal], value[decimal+1:]
+		grouping = "."
+		if value[decimal] == '.' {
+			grouping = ","
+		}
+	case hasComma:
+		if strings.Count(value, ",") > 1 {
+			return 0, fmt.Errorf("invalid number %q", raw)
+		}
+		whole, fraction, _ = strings.Cut(value, ",")
+	case hasDot:
+		if importGroupedNumbers["."].MatchString(value) {
+			grouping = "."
+		} else {
+			if strings.Count(value, ".") > 1 {
+				return 0, fmt.Errorf("invalid number %q", raw)
+			}
+			whole, fraction, _ = strings.Cut(value, ".")
+		}
+	}
+	if grouping != "" {
+		if !importGroupedNumbers[grouping].MatchString(whole) {
+			return 0, fmt.Errorf("invalid number %q", raw)
+		}
+		whole = strings.ReplaceAll(whole, grouping, "")
+	}
+	if fraction != "" {
+		whole += "." + fraction
+	}
+	return strconv.ParseFloat(whole, 64)
+}
+
+// importGroupedNumbers match whole numbers split in thousands by each
+// separator.
+var importGroupedNumbers = map[string]*regexp.Regexp{
+	".": regexp.MustCompile(`^-?\d{1,3}(\.\d{3})*$`),
+	",": regexp.MustCompile(`^-?\d{1,3}(,\d{3})*$`),
+}
+
+// saveRow creates the product or updates the one with the same SKU. It
+// returns the collections it had to create so the caller can cache them once
+// the savepoint is kept.
+func (imp *productImporter) saveRow(row *importRow) (bool, []models.Collection, error) {
+	ownerID := imp.job.OwnerID
+
+	var product models.Product
+	exists := false
+	if row.sku != nil {
+		err := imp.tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("owner_id = ? AND sku = ?", ownerID, *row.sku).
+			First(&product).Error
+		switch {
+		case err == nil:
+			exists = true
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return false, nil, err
+		}
+	}
+
+	if !exists {
+		row.errorField = ""
+		if row.name == nil {
+			row.errorField = models.ImportFieldName
+			return false, nil, newValidationError("name is required for new products")
+		}
+		if row.price == nil {
+			row.errorField = models.ImportFieldPrice
+			return false, nil, newValidationError("price is required for new products")
+		}
+		if err := ensureSKUsAvailable(imp.tx, ownerID, 0, row.sku, nil); err != nil {
+			row.errorField = models.ImportFieldSKU
+			return false, nil, err
+		}
+		product = models.Product{OwnerID: ownerID, SKU: row.sku, Status: models.ProductStatusPublished}
+	}
+
+	wasCounted := exists && product.Status != models.ProductStatusArchived
+	if row.name != nil {
+		product.Name = *row.name
+	}
+	if row.description != nil {
+		product.Description = *row.description
+	}
+	if row.price != nil {
+		product.Price = *row.price
+	}
+	if row.compareAtPrice != nil {
+		product.CompareAtPrice = row.compareAtPrice
+	}
+	if row.status != nil {
+		product.Status = *row.status
+	}
+	if err := validateProductPricing(&product); err != nil {
+		row.errorField = models.ImportFieldPrice
+		return false, nil, err
+	}
+
+	counted := product.Status != models.ProductStatusArchived
+	if counted && !wasCounted {
+		if imp.plan.MaxProducts != -1 && imp.productCount >= imp.plan.MaxProducts {
+			return false, nil, newValidationError("Product limit reached for plan %s", imp.plan.DisplayName)
+		}
+	}
+
+	collectionIDs, newCollections, err := imp.resolveCollections(row.collectionNames)
+	if err != nil {
+		row.errorField = models.ImportFieldCollections
+		return false, nil, err
+	}
+
+	if exists {
+		err = imp.tx.Model(&product).Select("name", "description", "price", "compare_at_price", "status").Updates(&product).Error
+	} else {
+		err = imp.tx.Omit(clause.Associations).Create(&product).Error
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	if row.collectionNames != nil {
+		if err := replaceProductCollections(imp.tx, product.ID, collectionIDs); err != nil {
+			return false, nil, err
+		}
+		if err := updateProductAttributes(imp.tx, product.ID, nil, false); err != nil {
+			row.errorField = models.ImportFieldCollections
+			return false, nil, err
+		}
+	}
+	if row.hasTags {
+		if err := replaceProductTags(imp.tx, &product, row.tags); err != nil {
+			return false, nil, err
+		}
+	}
+	if row.stockQuantity != nil {
+		if err := imp.importStock(&product, exists, *row.stockQuantity); err != nil {
+			row.errorField = models.ImportFieldStockQuantity
+			return false, nil, err
+		}
+	}
+
+	switch {
+	case counted && !wasCounted:
+		imp.productCount++
+	case !counted && wasCounted:
+		imp.productCount--
+	}
+	return !exists, newCollections, nil
+}
+
+// resolveCollections maps names to the owner's collections, matching
+// case-insensitively and creating the ones that do not exist yet.
+func (imp *productImporter) resolveCollections(names []string) ([]uint, []models.Collection, error) {
+	var ids []uint
+	var created []models.Collection
+	for _, name := range names {
+		if collection, ok := imp.collections[strings.ToLower(name)]; ok {
+			ids = append(ids, collection.ID)
+			continue
+		}
+		if imp.plan.MaxCollections != -1 && imp.collectionCount+len(created) >= imp.plan.MaxCollections {
+			return nil, nil, newValidationError("Collection limit reached for plan %s", imp.plan.DisplayName)
+		}
+		collection := models.Collection{OwnerID: imp.job.OwnerID, Name: name}
+		if err := imp.tx.Create(&collection).Error; err != nil {
+			return nil, nil, err
+		}
+		created = append(created, collection)
+		ids = append(ids, collection.ID)
+	}
+	ids, _ = requestedCollectionIDs(nil, ids)
+	return ids, created, nil
+}
+
+func (imp *productImporter) importStock(product *models.Product, exists bool, quantity int) error {
+	if product.Type == models.ProductTypeBundle {
+		return newValidationError("A bundle takes its stock from its products")
+	}
+	if exists {
+		var variantCount int64
+		if err := imp.tx.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&variantCount).Error; err != nil {
+			return err
+		}
+		if variantCount > 0 {
+			return newValidationError("Set stock on each variant for products with variants")
+		}
+	}
+
+	if !product.TrackStock {
+		if err := imp.tx.Model(product).Update("track_stock", true).Error; err != nil {
+			return err
+		}
+		product.TrackStock = true
+	}
+
+	reason := models.StockReasonAdjustment
+	if !exists {
+		reason = models.StockReasonInitial
+	}
+	return applyStockChange(imp.tx, stockChange{
+		Product: product,
+		UserID:  imp.job.OwnerID,
+		Before:  product.StockQuantity,
+		After:   quantity,
+		Reason:  reason,
+		Note:    fmt.Sprintf("Import #%d", imp.job.ID),
+	})
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+// stockChange describes a new stock level for a product or one of its
+// variants; the caller must hold a lock on the row being changed.
+type stockChange struct {
+	Product *models.Product
+	Variant *models.ProductVariant
+	UserID  uint
+	Before  int
+	After   int
+	Reason  string
+	Note    string
+}
+
+// applyStockChange stores the new level, appends it to the stock ledger and
+// notifies the owner when the level drops to the low-stock threshold.
+func applyStockChange(tx *gorm.DB, change stockChange) error {
+	if change.Before == change.After {
+		return nil
+	}
+
+	var variantID *uint
+	var err error
+	if change.Variant != nil {
+		variantID = &change.Variant.ID
+		err = tx.Model(&models.ProductVariant{}).Where("id = ?", change.Variant.ID).Update("stock_quantity", change.After).Error
+	} else {
+		err = tx.Model(&models.Product{}).Where("id = ?", change.Product.ID).Update("stock_quantity", change.After).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	movement := models.StockMovement{
+		OwnerID:       change.Product.OwnerID,
+		ProductID:     change.Product.ID,
+		VariantID:     variantID,
+		UserID:        change.UserID,
+		Delta:         change.After - change.Before,
+		QuantityAfter: change.After,
+		Reason:        change.Reason,
+		Note:          change.Note,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return err
+	}
+
+	threshold := change.Product.LowStockThreshold
+	if !change.Product.TrackStock || threshold == nil || change.Before <= *threshold || change.After > *threshold {
+		return nil
+	}
+
+	name := change.Product.Name
+	if change.Variant != nil {
+		name += " (" + variantLabel(change.Variant.Options) + ")"
+	}
+	notification := models.Notification{
+		UserID:    change.Product.OwnerID,
+		Type:      models.NotificationLowStock,
+		Message:   fmt.Sprintf("Estoque baixo: %s tem %d unidade(s) restante(s)", name, change.After),
+		ProductID: &change.Product.ID,
+	}
+	return tx.Create(&notification).Error
+}
+
+func variantLabel(options map[string]string) string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = options[name]
+	}
+	return strings.Join(values, " / ")
+}
+
+func AdjustProductStock(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.StockAdjustmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if (input.Delta == nil) == (input.Quantity == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either delta or quantity"})
+		return
+	}
+	if input.Reason == models.StockReasonInitial || !slices.Contains(models.StockReasons, input.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", uint(id), ownerID).
+			First(&product).Error; err != nil {
+			return err
+		}
+		if !product.TrackStock {
+			return newValidationError("Stock tracking is disabled for this product")
+		}
+
+		change := stockChange{Product: &product, UserID: ownerID, Reason: input.Reason, Note: input.Note}
+		if input.VariantID != nil {
+			var variant models.ProductVariant
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND product_id = ?", *input.VariantID, product.ID).
+				First(&variant).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return newValidationError("Invalid variant_id")
+				}
+				return err
+			}
+			change.Variant = &variant
+			change.Before = variant.StockQuantity
+		} else {
+			var variantCount int64
+			if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&variantCount).Error; err != nil {
+				return err
+			}
+			if variantCount > 0 {
+				return newValidationError("variant_id is required for products with variants")
+			}
+			change.Before = product.StockQuantity
+		}
+
+		if input.Delta != nil {
+			change.After = change.Before + *input.Delta
+		} else {
+			change.After = *input.Quantity
+		}
+		if change.After < 0 && !product.AllowBackorder {
+			return errInsufficientStock
+		}
+
+		return applyStockChange(tx, change)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		case errors.Is(err, errInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": "Insufficient stock"})
+		default:
+			respondValidationError(c, err, "Could not adjust stock")
+		}
+		return
+	}
+
+	var updated models.Product
+	if err := withProductDetails(database.DB).First(&updated, uint(id)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve updated product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func GetStockMovements(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var movements []models.StockMovement
+	if err := database.DB.Where("product_id = ? AND owner_id = ?", uint(id), ownerID).
+		Order("created_at desc, id desc").
+		Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, movements)
+}
+
+func GetMyNotifications(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	query := database.DB.Where("user_id = ?", ownerID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at desc").Limit(100).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", uint(id), ownerID).
+		Update("read_at", gorm.Expr("NOW()"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update notification"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
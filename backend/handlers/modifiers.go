@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxModifierGroups         = 10
+	maxModifierOptions        = 30
+	maxModifierOptionQuantity = 99
+)
+
+// quoteModifier is a chosen option on a quote line. UnitPrice is added to
+// each unit of the product Quantity times.
+type quoteModifier struct {
+	GroupID   uint    `json:"group_id"`
+	Group     string  `json:"group"`
+	OptionID  uint    `json:"option_id"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+type modifierProblem struct {
+	GroupID  uint   `json:"group_id,omitempty"`
+	OptionID uint   `json:"option_id,omitempty"`
+	Message  string `json:"message"`
+}
+
+func withModifierGroups(db *gorm.DB) *gorm.DB {
+	return db.Preload("ModifierGroups", orderByPosition).Preload("ModifierGroups.Options", orderByPosition)
+}
+
+func buildModifierGroups(inputs []models.ModifierGroupInput) ([]models.ModifierGroup, error) {
+	if len(inputs) > maxModifierGroups {
+		return nil, newValidationError("A product can have at most %d modifier groups", maxModifierGroups)
+	}
+
+	groups := make([]models.ModifierGroup, len(inputs))
+	groupNames := make([]string, 0, len(inputs))
+	for i, input := range inputs {
+		name := strings.TrimSpace(input.Name)
+		if name == "" {
+			return nil, newValidationError("Modifier group names cannot be empty")
+		}
+		if slices.Contains(groupNames, strings.ToLower(name)) {
+			return nil, newValidationError("Modifier group %q is listed more than once", name)
+		}
+		groupNames = append(groupNames, strings.ToLower(name))
+
+		maxSelect := input.MaxSelect
+		if maxSelect == 0 {
+			maxSelect = 1
+		}
+		if input.MinSelect < 0 || maxSelect < 0 || maxSelect < input.MinSelect {
+			return nil, newValidationError("Invalid selection limits for %q", name)
+		}
+		if len(input.Options) == 0 || len(input.Options) > maxModifierOptions {
+			return nil, newValidationError("%q needs between 1 and %d options", name, maxModifierOptions)
+		}
+
+		options := make([]models.ModifierOption, len(input.Options))
+		optionNames := make([]string, 0, len(input.Options))
+		reachable := 0
+		for j, optionInput := range input.Options {
+			optionName := strings.TrimSpace(optionInput.Name)
+			if optionName == "" {
+				return nil, newValidationError("Option names in %q cannot be empty", name)
+			}
+			if slices.Contains(optionNames, strings.ToLower(optionName)) {
+				return nil, newValidationError("Option %q is listed more than once in %q", optionName, name)
+			}
+			optionNames = append(optionNames, strings.ToLower(optionName))
+			if optionInput.Price < 0 {
+				return nil, newValidationError("The price of %q cannot be negative", optionName)
+			}
+			maxQuantity := optionInput.MaxQuantity
+			if maxQuantity == 0 {
+				maxQuantity = 1
+			}
+			if maxQuantity < 0 || maxQuantity > maxModifierOptionQuantity {
+				return nil, newValidationError("max_quantity for %q must be between 1 and %d", optionName, maxModifierOptionQuantity)
+			}
+			available := true
+			if optionInput.Available != nil {
+				available = *optionInput.Available
+			}
+			reachable += maxQuantity
+			options[j] = models.ModifierOption{
+				Name:        optionName,
+				Price:       roundMoney(optionInput.Price),
+				MaxQuantity: maxQuantity,
+				Available:   available,
+				Position:    j,
+			}
+		}
+		if reachable < input.MinSelect {
+			return nil, newValidationError("The options of %q cannot reach %d choices", name, input.MinSelect)
+		}
+
+		groups[i] = models.ModifierGroup{
+			Name:      name,
+			MinSelect: input.MinSelect,
+			MaxSelect: maxSelect,
+			Position:  i,
+			Options:   options,
+		}
+	}
+	return groups, nil
+}
+
+func replaceModifierGroups(tx *gorm.DB, productID uint, groups []models.ModifierGroup) error {
+	if err := tx.Where("group_id IN (?)", tx.Model(&models.ModifierGroup{}).Select("id").Where("product_id = ?", productID)).
+		Delete(&models.ModifierOption{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ModifierGroup{}).Error; err != nil {
+		return err
+	}
+	for i := range groups {
+		groups[i].ID = 0
+		groups[i].ProductID = productID
+		for j := range groups[i].Options {
+			groups[i].Options[j].ID = 0
+			groups[i].Options[j].GroupID = 0
+		}
+		if err := tx.Create(&groups[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneModifierGroups deep-copies groups so that saving the copy leaves the
+// originals untouched.
+func cloneModifierGroups(groups []models.ModifierGroup) []models.ModifierGroup {
+	cloned := slices.Clone(groups)
+	for i := range cloned {
+		cloned[i].Options = slices.Clone(cloned[i].Options)
+	}
+	return cloned
+}
+
+// selectModifiers checks the chosen options against the product's groups
+// and returns them with the amount they add to each unit. Every rule that is
+// broken is reported.
+func selectModifiers(groups []models.ModifierGroup, selections []models.ModifierSelectionInput) ([]quoteModifier, float64, []modifierProblem) {
+	selected := []quoteModifier{}
+	var problems []modifierProblem
+	counts := make([]int, len(groups))
+
+	for _, selection := range selections {
+		quantity := selection.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		if quantity < 0 {
+			problems = append(problems, modifierProblem{OptionID: selection.OptionID, Message: "Modifier quantities must be at least 1"})
+			continue
+		}
+
+		groupIndex, optionIndex := -1, -1
+		for i, group := range groups {
+			if j := slices.IndexFunc(group.Options, func(option models.ModifierOption) bool { return option.ID == selection.OptionID }); j >= 0 {
+				groupIndex, optionIndex = i, j
+				break
+			}
+		}
+		if groupIndex < 0 {
+			problems = append(problems, modifierProblem{OptionID: selection.OptionID, Message: fmt.Sprintf("Option %d does not belong to this product", selection.OptionID)})
+			continue
+		}
+		group, option := groups[groupIndex], groups[groupIndex].Options[optionIndex]
+		if !option.Available {
+			problems = append(problems, modifierProblem{GroupID: group.ID, OptionID: option.ID, Message: fmt.Sprintf("%s is not available", option.Name)})
+			continue
+		}
+
+		// The limit is checked before adding, so client quantities cannot
+		// overflow the totals.
+		index := slices.IndexFunc(selected, func(chosen quoteModifier) bool { return chosen.OptionID == option.ID })
+		var already int
+		if index >= 0 {
+			already = selected[index].Quantity
+		}
+		if quantity > option.MaxQuantity-already {
+			problems = append(problems, modifierProblem{GroupID: group.ID, OptionID: option.ID, Message: fmt.Sprintf("%s can be chosen at most %d times", option.Name, option.MaxQuantity)})
+			continue
+		}
+		if index < 0 {
+			selected = append(selected, quoteModifier{GroupID: group.ID, Group: group.Name, OptionID: option.ID, Name: option.Name, UnitPrice: option.Price})
+			index = len(selected) - 1
+		}
+		selected[index].Quantity += quantity
+		counts[groupIndex] += quantity
+	}
+
+	var perUnit float64
+	for _, chosen := range selected {
+		perUnit += chosen.UnitPrice * float64(chosen.Quantity)
+	}
+
+	for i, group := range groups {
+		var message string
+		switch {
+		case counts[i] < group.MinSelect && group.MinSelect == group.MaxSelect:
+			message = fmt.Sprintf("Choose %d in %s", group.MinSelect, group.Name)
+		case counts[i] < group.MinSelect:
+			message = fmt.Sprintf("Choose at least %d in %s", group.MinSelect, group.Name)
+		case counts[i] > group.MaxSelect:
+			message = fmt.Sprintf("Choose at most %d in %s", group.MaxSelect, group.Name)
+		default:
+			continue
+		}
+		problems = append(problems, modifierProblem{GroupID: group.ID, Message: message})
+	}
+	return selected, roundMoney(perUnit), problems
+}
+
+// PriceCatalogProduct checks the modifiers chosen for a product in a shared
+// catalog and prices the line, so menus can show totals the server agrees
+// with. Every broken modifier rule is listed under errors.
+func PriceCatalogProduct(c *gin.Context) {
+	collection, ok := findSharedCollection(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.ProductPriceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
+
+	var product models.Product
+	if err := quotableProducts(collection).Where("products.id = ?", uint(id)).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute price"})
+		return
+	}
+
+	if _, _, problems := selectModifiers(product.ModifierGroups, input.Modifiers); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problems[0].Message, "errors": problems})
+		return
+	}
+
+	quote, err := buildQuote([]models.Product{product}, []models.QuoteItemInput{{
+		ProductID: product.ID,
+		VariantID: input.VariantID,
+		Quantity:  input.Quantity,
+		Modifiers: input.Modifiers,
+	}})
+	if err != nil {
+		respondValidationError(c, err, "Could not compute price")
+		return
+	}
+
+	c.JSON(http.StatusOK, quote.Items[0])
+}
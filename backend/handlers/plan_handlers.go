@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func GetPlans(c *gin.Context) {
@@ -41,11 +44,8 @@ func GetMyPlanInfo(c *gin.Context) {
 		user.Plan = &freePlan
 	}
 
-	var productCount int64
-	database.DB.Model(&models.Product{}).Where("owner_id = ?", ownerID).Count(&productCount)
-
-	var collectionCount int64
-	database.DB.Model(&models.Collection{}).Where("owner_id = ?", ownerID).Count(&collectionCount)
+	productCount, _ := countProducts(database.DB, ownerID)
+	collectionCount, _ := countCollections(database.DB, ownerID)
 
 	canCreateProduct := user.Plan.MaxProducts == -1 || int(productCount) < user.Plan.MaxProducts
 	canCreateCollection := user.Plan.MaxCollections == -1 || int(collectionCount) < user.Plan.MaxCollections
@@ -61,46 +61,111 @@ func GetMyPlanInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, planInfo)
 }
 
-func CheckProductLimit(ownerID uint) (bool, *models.Plan, int, error) {
+var errPlanLimitReached = errors.New("plan limit reached")
+
+// loadOwnerPlan locks the owner's row for the rest of the transaction so that
+// concurrent quota checks for the same owner are serialized.
+func loadOwnerPlan(tx *gorm.DB, ownerID uint) (*models.Plan, error) {
+	return findOwnerPlan(tx, ownerID, true)
+}
+
+func findOwnerPlan(tx *gorm.DB, ownerID uint, lock bool) (*models.Plan, error) {
+	users := tx
+	if lock {
+		users = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
 	var user models.User
-	if err := database.DB.Preload("Plan").First(&user, ownerID).Error; err != nil {
-		return false, nil, 0, err
+	if err := users.First(&user, ownerID).Error; err != nil {
+		return nil, err
 	}
 
-	if user.Plan == nil {
-		var freePlan models.Plan
-		if err := database.DB.Where("name = ?", "free").First(&freePlan).Error; err != nil {
-			return false, nil, 0, err
+	var plan models.Plan
+	if err := tx.First(&plan, user.PlanID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err := tx.Where("name = ?", "free").First(&plan).Error; err != nil {
+			return nil, err
 		}
-		user.Plan = &freePlan
 	}
 
-	var productCount int64
-	database.DB.Model(&models.Product{}).Where("owner_id = ?", ownerID).Count(&productCount)
+	return &plan, nil
+}
 
-	canCreate := user.Plan.MaxProducts == -1 || int(productCount) < user.Plan.MaxProducts
-	return canCreate, user.Plan, int(productCount), nil
+func countProducts(db *gorm.DB, ownerID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Product{}).Where("owner_id = ? AND status <> ?", ownerID, models.ProductStatusArchived).Count(&count).Error
+	return count, err
 }
 
-func CheckCollectionLimit(ownerID uint) (bool, *models.Plan, int, error) {
-	var user models.User
-	if err := database.DB.Preload("Plan").First(&user, ownerID).Error; err != nil {
+func countCollections(db *gorm.DB, ownerID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Collection{}).Where("owner_id = ?", ownerID).Count(&count).Error
+	return count, err
+}
+
+// CheckProductLimit is only authoritative inside the transaction that inserts
+// the product; the owner row stays locked until that transaction ends.
+func CheckProductLimit(tx *gorm.DB, ownerID uint) (bool, *models.Plan, int, error) {
+	return CheckProductCapacity(tx, ownerID, 1)
+}
+
+// productLimitHint reads the product quota without locking anything. It
+// lets a request fail fast before its uploads are stored; only
+// CheckProductLimit inside the insert transaction is authoritative.
+func productLimitHint(db *gorm.DB, ownerID uint) (bool, *models.Plan, int, error) {
+	plan, err := findOwnerPlan(db, ownerID, false)
+	if err != nil {
+		return false, nil, 0, err
+	}
+	productCount, err := countProducts(db, ownerID)
+	if err != nil {
 		return false, nil, 0, err
 	}
+	return plan.MaxProducts == -1 || int(productCount) < plan.MaxProducts, plan, int(productCount), nil
+}
 
-	if user.Plan == nil {
-		var freePlan models.Plan
-		if err := database.DB.Where("name = ?", "free").First(&freePlan).Error; err != nil {
-			return false, nil, 0, err
-		}
-		user.Plan = &freePlan
+// CheckProductCapacity is CheckProductLimit for inserting several products.
+func CheckProductCapacity(tx *gorm.DB, ownerID uint, newProducts int) (bool, *models.Plan, int, error) {
+	plan, err := loadOwnerPlan(tx, ownerID)
+	if err != nil {
+		return false, nil, 0, err
 	}
 
-	var collectionCount int64
-	database.DB.Model(&models.Collection{}).Where("owner_id = ?", ownerID).Count(&collectionCount)
+	productCount, err := countProducts(tx, ownerID)
+	if err != nil {
+		return false, nil, 0, err
+	}
 
-	canCreate := user.Plan.MaxCollections == -1 || int(collectionCount) < user.Plan.MaxCollections
-	return canCreate, user.Plan, int(collectionCount), nil
+	canCreate := plan.MaxProducts == -1 || int(productCount)+newProducts <= plan.MaxProducts
+	return canCreate, plan, int(productCount), nil
+}
+
+// CheckCollectionLimit is only authoritative inside the transaction that
+// inserts the collection; the owner row stays locked until that transaction ends.
+func CheckCollectionLimit(tx *gorm.DB, ownerID uint) (bool, *models.Plan, int, error) {
+	plan, err := loadOwnerPlan(tx, ownerID)
+	if err != nil {
+		return false, nil, 0, err
+	}
+
+	collectionCount, err := countCollections(tx, ownerID)
+	if err != nil {
+		return false, nil, 0, err
+	}
+
+	canCreate := plan.MaxCollections == -1 || int(collectionCount) < plan.MaxCollections
+	return canCreate, plan, int(collectionCount), nil
+}
+
+func respondPlanLimit(c *gin.Context, message string, limit int, plan *models.Plan, currentCount int) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":            message,
+		"limit":            limit,
+		"current_count":    currentCount,
+		"plan_name":        plan.DisplayName,
+		"upgrade_required": true,
+	})
 }
 
 func UpgradePlan(c *gin.Context) {
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const concurrentCreations = 25
+
+// connectTestDatabase connects to the Postgres database named by TEST_DB_NAME,
+// with the other DB_* variables of the application. Tests that need it are
+// skipped when it is not set, so they never touch a development database.
+func connectTestDatabase(t *testing.T) {
+	t.Helper()
+	name := os.Getenv("TEST_DB_NAME")
+	if name == "" {
+		t.Skip("TEST_DB_NAME is not set")
+	}
+	if database.DB == nil {
+		t.Setenv("DB_NAME", name)
+		database.ConnectDatabase()
+	}
+
+	uploads, err := storage.NewLocal(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Uploads = uploads
+}
+
+// createTestOwner creates a user on the free plan and removes it, with
+// everything it owns, when the test ends.
+func createTestOwner(t *testing.T) (*models.User, *models.Plan) {
+	t.Helper()
+	var plan models.Plan
+	if err := database.DB.Where("name = ?", "free").First(&plan).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	suffix := time.Now().UnixNano()
+	user := models.User{
+		Username: fmt.Sprintf("limits-%d", suffix),
+		Email:    fmt.Sprintf("limits-%d@example.com", suffix),
+		Password: "unused",
+		Number:   fmt.Sprintf("%d", suffix),
+		PlanID:   plan.ID,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		database.DB.Exec("DELETE FROM product_collections WHERE product_id IN (SELECT id FROM products WHERE owner_id = ?)", user.ID)
+		database.DB.Exec("DELETE FROM stock_movements WHERE product_id IN (SELECT id FROM products WHERE owner_id = ?)", user.ID)
+		database.DB.Exec("DELETE FROM revisions WHERE owner_id = ?", user.ID)
+		database.DB.Exec("DELETE FROM products WHERE owner_id = ?", user.ID)
+		database.DB.Exec("DELETE FROM collections WHERE owner_id = ?", user.ID)
+		database.DB.Delete(&user)
+	})
+	return &user, &plan
+}
+
+func ownerRouter(ownerID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", ownerID)
+	})
+	router.POST("/products", CreateProduct)
+	router.POST("/collections", CreateCollection)
+	return router
+}
+
+// createConcurrently sends the requests built by newRequest at the same time
+// and counts the responses by status.
+func createConcurrently(router *gin.Engine, newRequest func(i int) *http.Request) map[int]int {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		statuses = map[int]int{}
+		start    = make(chan struct{})
+	)
+	for i := 0; i < concurrentCreations; i++ {
+		request := newRequest(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			mu.Lock()
+			statuses[recorder.Code]++
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return statuses
+}
+
+func TestConcurrentProductCreationsStayWithinPlan(t *testing.T) {
+	connectTestDatabase(t)
+	owner, plan := createTestOwner(t)
+	router := ownerRouter(owner.ID)
+
+	statuses := createConcurrently(router, func(i int) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("name", fmt.Sprintf("Product %d", i))
+		form.WriteField("description", "Created concurrently")
+		form.WriteField("price", "10")
+		form.Close()
+		request := httptest.NewRequest(http.MethodPost, "/products", &body)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		return request
+	})
+
+	count, err := countProducts(database.DB, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(count) != plan.MaxProducts {
+		t.Errorf("owner has %d products, want the plan limit of %d", count, plan.MaxProducts)
+	}
+	if statuses[http.StatusCreated] != plan.MaxProducts || statuses[http.StatusForbidden] != concurrentCreations-plan.MaxProducts {
+		t.Errorf("statuses = %v, want %d created and the rest forbidden", statuses, plan.MaxProducts)
+	}
+}
+
+func TestConcurrentCollectionCreationsStayWithinPlan(t *testing.T) {
+	connectTestDatabase(t)
+	owner, plan := createTestOwner(t)
+	router := ownerRouter(owner.ID)
+
+	statuses := createConcurrently(router, func(i int) *http.Request {
+		body := fmt.Sprintf(`{"name": "Collection %d"}`, i)
+		request := httptest.NewRequest(http.MethodPost, "/collections", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		return request
+	})
+
+	count, err := countCollections(database.DB, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(count) != plan.MaxCollections {
+		t.Errorf("owner has %d collections, want the plan limit of %d", count, plan.MaxCollections)
+	}
+	if statuses[http.StatusCreated] != plan.MaxCollections || statuses[http.StatusForbidden] != concurrentCreations-plan.MaxCollections {
+		t.Errorf("statuses = %v, want %d created and the rest forbidden", statuses, plan.MaxCollections)
+	}
+}
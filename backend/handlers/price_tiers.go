@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPriceTiers = 10
+	maxQuoteItems = 200
+)
+
+type quoteLine struct {
+	ProductID       uint            `json:"product_id"`
+	VariantID       *uint           `json:"variant_id"`
+	Name            string          `json:"name"`
+	Variant         string          `json:"variant,omitempty"`
+	SaleUnit        string          `json:"sale_unit"`
+	Quantity        float64         `json:"quantity"`
+	UnitPrice       float64         `json:"unit_price"`
+	TierMinQuantity *float64        `json:"tier_min_quantity"`
+	Modifiers       []quoteModifier `json:"modifiers"`
+	ModifiersPrice  float64         `json:"modifiers_price"`
+	LineTotal       float64         `json:"line_total"`
+}
+
+type quoteResponse struct {
+	Items []quoteLine `json:"items"`
+	Total float64     `json:"total"`
+}
+
+func normalizeSaleUnit(unit string) (string, error) {
+	if unit == "" {
+		return models.SaleUnitUnit, nil
+	}
+	if !slices.Contains(models.SaleUnits, unit) {
+		return "", newValidationError("Invalid sale_unit")
+	}
+	return unit, nil
+}
+
+// validateQuantity accepts positive quantities, and only whole ones unless
+// the product is sold by weight.
+func validateQuantity(field string, quantity float64, saleUnit string) error {
+	if quantity <= 0 {
+		return newValidationError("%s must be greater than zero", field)
+	}
+	if saleUnit != models.SaleUnitKg && quantity != math.Trunc(quantity) {
+		return newValidationError("%s must be a whole number", field)
+	}
+	return nil
+}
+
+// buildPriceTiers checks the tiers of a product and sorts them by quantity.
+func buildPriceTiers(inputs []models.PriceTierInput, saleUnit string) ([]models.PriceTier, error) {
+	if len(inputs) > maxPriceTiers {
+		return nil, newValidationError("A product can have at most %d price tiers", maxPriceTiers)
+	}
+
+	tiers := make([]models.PriceTier, len(inputs))
+	for i, input := range inputs {
+		if err := validateQuantity("min_quantity", input.MinQuantity, saleUnit); err != nil {
+			return nil, err
+		}
+		if input.UnitPrice <= 0 {
+			return nil, newValidationError("unit_price must be greater than zero")
+		}
+		tiers[i] = models.PriceTier{MinQuantity: input.MinQuantity, UnitPrice: input.UnitPrice}
+	}
+	slices.SortFunc(tiers, func(a, b models.PriceTier) int { return cmp.Compare(a.MinQuantity, b.MinQuantity) })
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].MinQuantity == tiers[i-1].MinQuantity {
+			return nil, newValidationError("Two price tiers start at %v", tiers[i].MinQuantity)
+		}
+	}
+	return tiers, nil
+}
+
+// ensureTiersFitSaleUnit checks the stored tiers of a product against a new
+// sale unit, for changes that keep the tiers as they are.
+func ensureTiersFitSaleUnit(tx *gorm.DB, productID uint, saleUnit string) error {
+	var tiers []models.PriceTier
+	if err := tx.Where("product_id = ?", productID).Order("min_quantity asc").Find(&tiers).Error; err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		if validateQuantity("min_quantity", tier.MinQuantity, saleUnit) != nil {
+			return newValidationError("The price tier from %v does not fit sale_unit %q; send price_tiers too", tier.MinQuantity, saleUnit)
+		}
+	}
+	return nil
+}
+
+func replacePriceTiers(tx *gorm.DB, productID uint, tiers []models.PriceTier) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.PriceTier{}).Error; err != nil {
+		return err
+	}
+	for i := range tiers {
+		tiers[i].ID = 0
+		tiers[i].ProductID = productID
+		if err := tx.Create(&tiers[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func orderByMinQuantity(db *gorm.DB) *gorm.DB {
+	return db.Order("min_quantity asc")
+}
+
+// tierFor returns the tier reached by the quantity, if any. Tiers must be
+// sorted by quantity.
+func tierFor(tiers []models.PriceTier, quantity float64) *models.PriceTier {
+	var reached *models.PriceTier
+	for i := range tiers {
+		if quantity >= tiers[i].MinQuantity {
+			reached = &tiers[i]
+		}
+	}
+	return reached
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// QuoteCatalogOrder prices a cart from a shared catalog. The quantities of
+// every line of a product add up to pick its price tier and to meet its
+// minimum order.
+func QuoteCatalogOrder(c *gin.Context) {
+	collection, ok := findSharedCollection(c)
+	if !ok {
+		return
+	}
+
+	var input models.QuoteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if len(input.Items) == 0 || len(input.Items) > maxQuoteItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Send between 1 and %d items", maxQuoteItems)})
+		return
+	}
+
+	productIDs := make([]uint, len(input.Items))
+	for i, item := range input.Items {
+		productIDs[i] = item.ProductID
+	}
+	var products []models.Product
+	if err := quotableProducts(collection).Where("products.id IN ?", productIDs).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute quote"})
+		return
+	}
+
+	quote, err := buildQuote(products, input.Items)
+	if err != nil {
+		respondValidationError(c, err, "Could not compute quote")
+		return
+	}
+	recordQuoteAffinities(c, collection, &input)
+
+	c.JSON(http.StatusOK, quote)
+}
+
+// quotableProducts loads the products of a shared catalog with everything
+// buildQuote needs.
+func quotableProducts(collection *models.Collection) *gorm.DB {
+	return withModifierGroups(withBundleItems(catalogProducts(collection))).
+		Preload("Variants").
+		Preload("PriceTiers", orderByMinQuantity)
+}
+
+type quoteStockKey struct {
+	productID uint
+	variantID uint
+}
+
+func newQuoteStockKey(item models.QuoteItemInput) quoteStockKey {
+	key := quoteStockKey{productID: item.ProductID}
+	if item.VariantID != nil {
+		key.variantID = *item.VariantID
+	}
+	return key
+}
+
+func buildQuote(products []models.Product, items []models.QuoteItemInput) (*quoteResponse, error) {
+	byID := make(map[uint]*models.Product, len(products))
+	for i := range products {
+		byID[products[i].ID] = &products[i]
+	}
+
+	// Stock, like tiers and minimums, applies to what the whole cart asks
+	// for, so lines for the same product or variant are added up.
+	totals := map[uint]float64{}
+	stockTotals := map[quoteStockKey]float64{}
+	for _, item := range items {
+		product, ok := byID[item.ProductID]
+		if !ok {
+			return nil, newValidationError("Product %d is not in this catalog", item.ProductID)
+		}
+		if err := validateQuantity("quantity", item.Quantity, product.SaleUnit); err != nil {
+			return nil, err
+		}
+		totals[product.ID] += item.Quantity
+		stockTotals[newQuoteStockKey(item)] += item.Quantity
+	}
+	for _, product := range products {
+		if totals[product.ID] < product.MinOrderQuantity {
+			return nil, newValidationError("The minimum order for %q is %v", product.Name, product.MinOrderQuantity)
+		}
+	}
+
+	quote := &quoteResponse{Items: make([]quoteLine, 0, len(items))}
+	for _, item := range items {
+		product := byID[item.ProductID]
+		line := quoteLine{
+			ProductID: product.ID,
+			VariantID: item.VariantID,
+			Name:      product.Name,
+			SaleUnit:  product.SaleUnit,
+			Quantity:  item.Quantity,
+			UnitPrice: product.EffectivePrice,
+		}
+		stock := product.StockQuantity
+
+		if len(product.Variants) > 0 {
+			if item.VariantID == nil {
+				return nil, newValidationError("Choose a variant of %q", product.Name)
+			}
+			index := slices.IndexFunc(product.Variants, func(variant models.ProductVariant) bool { return variant.ID == *item.VariantID })
+			if index < 0 {
+				return nil, newValidationError("Variant %d does not belong to %q", *item.VariantID, product.Name)
+			}
+			variant := product.Variants[index]
+			if !variant.Available {
+				return nil, newValidationError("%q (%s) is not available", product.Name, variantLabel(variant.Options))
+			}
+			line.Variant = variantLabel(variant.Options)
+			if variant.Price != nil {
+				line.UnitPrice = *variant.Price
+			}
+			stock = variant.StockQuantity
+		} else if item.VariantID != nil {
+			return nil, newValidationError("%q has no variants", product.Name)
+		}
+
+		if product.TrackStock && !product.AllowBackorder && stockTotals[newQuoteStockKey(item)] > float64(stock) {
+			return nil, newValidationError("Only %d of %q available", stock, product.Name)
+		}
+		if product.Type == models.ProductTypeBundle && !product.BundleAvailableFor(totals[product.ID]) {
+			return nil, newValidationError("Not enough stock to make %v of %q", totals[product.ID], product.Name)
+		}
+
+		modifiers, modifiersPrice, problems := selectModifiers(product.ModifierGroups, item.Modifiers)
+		if len(problems) > 0 {
+			return nil, newValidationError("%s: %s", product.Name, problems[0].Message)
+		}
+		line.Modifiers = modifiers
+		line.ModifiersPrice = modifiersPrice
+
+		// Tiers discount the product itself, never its modifiers.
+		if tier := tierFor(product.PriceTiers, totals[product.ID]); tier != nil && tier.UnitPrice < line.UnitPrice {
+			line.UnitPrice = tier.UnitPrice
+			line.TierMinQuantity = &tier.MinQuantity
+		}
+		line.LineTotal = roundMoney((line.UnitPrice + line.ModifiersPrice) * line.Quantity)
+		quote.Total += line.LineTotal
+		quote.Items = append(quote.Items, line)
+	}
+	quote.Total = roundMoney(quote.Total)
+	return quote, nil
+}
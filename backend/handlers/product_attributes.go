@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxProductAttributes  = 50
+	maxAttributeKeyLength = 100
+)
+
+// buildProductAttributes checks attribute inputs and turns them into rows in
+// the order given.
+func buildProductAttributes(inputs []models.ProductAttributeInput) ([]models.ProductAttribute, error) {
+	if len(inputs) > maxProductAttributes {
+		return nil, newValidationError("A product can have at most %d attributes", maxProductAttributes)
+	}
+
+	attributes := make([]models.ProductAttribute, 0, len(inputs))
+	seen := map[string]bool{}
+	for i, input := range inputs {
+		key := strings.TrimSpace(input.Key)
+		if key == "" {
+			return nil, newValidationError("Attribute key is required")
+		}
+		if len([]rune(key)) > maxAttributeKeyLength {
+			return nil, newValidationError("Attribute key %q is too long", key)
+		}
+		if seen[strings.ToLower(key)] {
+			return nil, newValidationError("Attribute %q is used more than once", key)
+		}
+		seen[strings.ToLower(key)] = true
+
+		attribute := models.ProductAttribute{Key: key, Type: input.Type, Unit: strings.TrimSpace(input.Unit), Position: i}
+		if attribute.Type == "" {
+			attribute.Type = inferAttributeType(input.Value)
+		}
+		if err := setAttributeValue(&attribute, input.Value); err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes, nil
+}
+
+func inferAttributeType(value any) string {
+	switch value.(type) {
+	case float64:
+		return models.AttributeTypeNumber
+	case bool:
+		return models.AttributeTypeBoolean
+	case []any:
+		return models.AttributeTypeList
+	default:
+		return models.AttributeTypeText
+	}
+}
+
+func setAttributeValue(attribute *models.ProductAttribute, value any) error {
+	switch attribute.Type {
+	case models.AttributeTypeText:
+		text, ok := value.(string)
+		if !ok || strings.TrimSpace(text) == "" {
+			return newValidationError("Attribute %q must be a text", attribute.Key)
+		}
+		text = strings.TrimSpace(text)
+		attribute.TextValue = &text
+	case models.AttributeTypeNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return newValidationError("Attribute %q must be a number", attribute.Key)
+		}
+		attribute.NumberValue = &number
+	case models.AttributeTypeBoolean:
+		boolean, ok := value.(bool)
+		if !ok {
+			return newValidationError("Attribute %q must be true or false", attribute.Key)
+		}
+		attribute.BoolValue = &boolean
+	case models.AttributeTypeList:
+		items, ok := value.([]any)
+		if !ok || len(items) == 0 {
+			return newValidationError("Attribute %q must be a list of texts", attribute.Key)
+		}
+		attribute.ListValue = make([]string, 0, len(items))
+		for _, item := range items {
+			text, ok := item.(string)
+			if !ok || strings.TrimSpace(text) == "" {
+				return newValidationError("Attribute %q must be a list of texts", attribute.Key)
+			}
+			attribute.ListValue = append(attribute.ListValue, strings.TrimSpace(text))
+		}
+	default:
+		return newValidationError("Invalid type for attribute %q", attribute.Key)
+	}
+	if attribute.Type != models.AttributeTypeNumber && attribute.Unit != "" {
+		return newValidationError("Only number attributes can have a unit")
+	}
+	attribute.RefreshValue()
+	return nil
+}
+
+// validateAttributeSchemas checks attributes against the schemas of the
+// given collections. Keys are matched case-insensitively and take the
+// spelling of the schema; a number without a unit takes the schema's unit.
+func validateAttributeSchemas(tx *gorm.DB, collectionIDs []uint, attributes []models.ProductAttribute) error {
+	if len(collectionIDs) == 0 {
+		return nil
+	}
+
+	var definitions []models.AttributeDefinition
+	if err := tx.Where("collection_id IN ?", collectionIDs).Order("collection_id, position").Find(&definitions).Error; err != nil {
+		return err
+	}
+
+	for _, definition := range definitions {
+		index := slices.IndexFunc(attributes, func(attribute models.ProductAttribute) bool {
+			return strings.EqualFold(attribute.Key, definition.Key)
+		})
+		if index < 0 {
+			if definition.Required {
+				return newValidationError("Attribute %q is required", definition.Key)
+			}
+			continue
+		}
+
+		attribute := &attributes[index]
+		attribute.Key = definition.Key
+		if attribute.Type != definition.Type {
+			return newValidationError("Attribute %q must be of type %s", definition.Key, definition.Type)
+		}
+		if attribute.Type == models.AttributeTypeNumber && definition.Unit != "" {
+			if attribute.Unit == "" {
+				attribute.Unit = definition.Unit
+			} else if !strings.EqualFold(attribute.Unit, definition.Unit) {
+				return newValidationError("Attribute %q must be in %s", definition.Key, definition.Unit)
+			}
+		}
+		if len(definition.Options) > 0 {
+			values := attribute.ListValue
+			if attribute.TextValue != nil {
+				values = []string{*attribute.TextValue}
+			}
+			for _, value := range values {
+				if !slices.ContainsFunc(definition.Options, func(option string) bool { return strings.EqualFold(option, value) }) {
+					return newValidationError("%q is not a valid value for attribute %q", value, definition.Key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func replaceProductAttributes(tx *gorm.DB, productID uint, attributes []models.ProductAttribute) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductAttribute{}).Error; err != nil {
+		return err
+	}
+	for i := range attributes {
+		attributes[i].ID = 0
+		attributes[i].ProductID = productID
+		if err := tx.Create(&attributes[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateProductAttributes validates the product's attributes against the
+// schemas of the collections it is in now, using the stored attributes
+// unless replace is set, and saves them.
+func updateProductAttributes(tx *gorm.DB, productID uint, attributes []models.ProductAttribute, replace bool) error {
+	if !replace {
+		if err := orderByPosition(tx.Where("product_id = ?", productID)).Find(&attributes).Error; err != nil {
+			return err
+		}
+	}
+
+	var collectionIDs []uint
+	if err := liveCollectionLinks(tx.Model(&models.ProductCollection{})).
+		Where("product_id = ?", productID).
+		Pluck("collection_id", &collectionIDs).Error; err != nil {
+		return err
+	}
+	if err := validateAttributeSchemas(tx, collectionIDs, attributes); err != nil {
+		return err
+	}
+	return replaceProductAttributes(tx, productID, attributes)
+}
+
+// withAttributes keeps products matching every attribute filter. A value
+// matches text case-insensitively, numbers and booleans exactly, and lists
+// when it is one of the items.
+func withAttributes(query *gorm.DB, values map[string]string, minimums, maximums map[string]float64) *gorm.DB {
+	const exists = "EXISTS (SELECT 1 FROM product_attributes WHERE product_attributes.product_id = products.id AND LOWER(product_attributes.key) = LOWER(?) AND "
+
+	for _, key := range sortedKeys(values) {
+		value := values[key]
+		conditions := []string{"LOWER(product_attributes.text_value) = LOWER(?)", "product_attributes.list_value::jsonb @> ?::jsonb"}
+		item, _ := json.Marshal([]string{value})
+		args := []any{key, value, string(item)}
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			conditions = append(conditions, "product_attributes.number_value = ?")
+			args = append(args, number)
+		}
+		if boolean, err := strconv.ParseBool(value); err == nil {
+			conditions = append(conditions, "product_attributes.bool_value = ?")
+			args = append(args, boolean)
+		}
+		query = query.Where(exists+"("+strings.Join(conditions, " OR ")+"))", args...)
+	}
+	for _, key := range sortedKeys(minimums) {
+		query = query.Where(exists+"product_attributes.number_value >= ?)", key, minimums[key])
+	}
+	for _, key := range sortedKeys(maximums) {
+		query = query.Where(exists+"product_attributes.number_value <= ?)", key, maximums[key])
+	}
+	return query
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func GetAttributeSchema(c *gin.Context) {
+	ownerID, id, ok := collectionRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("id = ? AND owner_id = ?", id, ownerID).First(&models.Collection{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+		return
+	}
+
+	definitions := []models.AttributeDefinition{}
+	if err := orderByPosition(database.DB.Where("collection_id = ?", id)).Find(&definitions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve attribute schema"})
+		return
+	}
+
+	c.JSON(http.StatusOK, definitions)
+}
+
+// UpdateAttributeSchema replaces the attribute schema of a collection. The
+// schema applies to products saved from then on; existing products are not
+// checked again.
+func UpdateAttributeSchema(c *gin.Context) {
+	ownerID, id, ok := collectionRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var input models.UpdateAttributeSchemaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	definitions, err := buildAttributeDefinitions(input.Attributes)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOwnedCollection(tx, ownerID, id); err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id = ?", id).Delete(&models.AttributeDefinition{}).Error; err != nil {
+			return err
+		}
+		for i := range definitions {
+			definitions[i].CollectionID = id
+			if err := tx.Create(&definitions[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update attribute schema"})
+		return
+	}
+
+	c.JSON(http.StatusOK, definitions)
+}
+
+func buildAttributeDefinitions(inputs []models.AttributeDefinitionInput) ([]models.AttributeDefinition, error) {
+	if len(inputs) > maxProductAttributes {
+		return nil, newValidationError("A schema can have at most %d attributes", maxProductAttributes)
+	}
+
+	definitions := make([]models.AttributeDefinition, 0, len(inputs))
+	seen := map[string]bool{}
+	for i, input := range inputs {
+		key := strings.TrimSpace(input.Key)
+		if key == "" {
+			return nil, newValidationError("Attribute key is required")
+		}
+		if len([]rune(key)) > maxAttributeKeyLength {
+			return nil, newValidationError("Attribute key %q is too long", key)
+		}
+		if seen[strings.ToLower(key)] {
+			return nil, newValidationError("Attribute %q is used more than once", key)
+		}
+		seen[strings.ToLower(key)] = true
+
+		if !slices.Contains(models.AttributeTypes, input.Type) {
+			return nil, newValidationError("Invalid type for attribute %q", key)
+		}
+		unit := strings.TrimSpace(input.Unit)
+		if unit != "" && input.Type != models.AttributeTypeNumber {
+			return nil, newValidationError("Only number attributes can have a unit")
+		}
+		options := make([]string, 0, len(input.Options))
+		for _, option := range input.Options {
+			if option = strings.TrimSpace(option); option != "" {
+				options = append(options, option)
+			}
+		}
+		if len(options) > 0 && input.Type != models.AttributeTypeText && input.Type != models.AttributeTypeList {
+			return nil, newValidationError("Only text and list attributes can have options")
+		}
+
+		definitions = append(definitions, models.AttributeDefinition{
+			Key:      key,
+			Type:     input.Type,
+			Unit:     unit,
+			Required: input.Required,
+			Options:  options,
+			Position: i,
+		})
+	}
+	return definitions, nil
+}
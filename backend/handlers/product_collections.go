@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxTagsPerProduct = 20
+	maxTagNameRunes   = 40
+)
+
+// requestedCollectionIDs merges the legacy collection_id with collection_ids.
+// The second result is false when the request does not touch collections.
+// Multipart clients clear the set by sending an empty collection_ids value,
+// which binds as a zero id.
+func requestedCollectionIDs(legacy *uint, ids []uint) ([]uint, bool) {
+	if ids == nil {
+		if legacy == nil {
+			return nil, false
+		}
+		ids = []uint{*legacy}
+	}
+
+	result := make([]uint, 0, len(ids))
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result, true
+}
+
+// normalizeTagNames trims and de-duplicates tag names case-insensitively,
+// keeping the first spelling that was sent.
+func normalizeTagNames(names []string) ([]string, error) {
+	result := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > maxTagNameRunes {
+			return nil, newValidationError("Tag %q is too long", name)
+		}
+		seen[strings.ToLower(name)] = true
+		result = append(result, name)
+	}
+	if len(result) > maxTagsPerProduct {
+		return nil, newValidationError("A product can have at most %d tags", maxTagsPerProduct)
+	}
+	return result, nil
+}
+
+func ensureOwnedCollections(tx *gorm.DB, ownerID uint, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Collection{}).Where("id IN ? AND owner_id = ?", ids, ownerID).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return newValidationError("Invalid collection_id")
+	}
+	return nil
+}
+
+// replaceProductCollections links the product to exactly the given
+// collections, keeping links that already exist untouched.
+func replaceProductCollections(tx *gorm.DB, productID uint, ids []uint) error {
+	unlink := tx.Where("product_id = ?", productID)
+	if len(ids) > 0 {
+		unlink = unlink.Where("collection_id NOT IN ?", ids)
+	}
+	if err := unlink.Delete(&models.ProductCollection{}).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	links := make([]models.ProductCollection, len(ids))
+	for i, id := range ids {
+		links[i] = models.ProductCollection{ProductID: productID, CollectionID: id}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+}
+
+// replaceProductTags sets the product's tags, creating owner tags that do not
+// exist yet. Names match existing tags case-insensitively.
+func replaceProductTags(tx *gorm.DB, product *models.Product, names []string) error {
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		tag, err := upsertTag(tx, product.OwnerID, name)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, *tag)
+	}
+	return tx.Model(product).Association("Tags").Replace(tags)
+}
+
+// upsertTag returns the owner's tag with the given name in any case,
+// creating it when there is none. The insert goes first so that concurrent
+// saves of "Promo" and "promo" end up with one tag: the unique index on
+// LOWER(name) makes the later one wait and then find the earlier one.
+func upsertTag(tx *gorm.DB, ownerID uint, name string) (*models.Tag, error) {
+	tag := models.Tag{OwnerID: ownerID, Name: name}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &tag, nil
+	}
+	tag = models.Tag{}
+	if err := tx.Where("owner_id = ? AND LOWER(name) = LOWER(?)", ownerID, name).First(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(strings.TrimSpace(value))
+	}
+	return lowered
+}
+
+// withTags keeps products carrying at least one of the given tag names.
+func withTags(query *gorm.DB, names []string) *gorm.DB {
+	if len(names) == 0 {
+		return query
+	}
+	return query.Where(
+		"EXISTS (SELECT 1 FROM product_tags JOIN tags ON tags.id = product_tags.tag_id "+
+			"WHERE product_tags.product_id = products.id AND LOWER(tags.name) IN ?)",
+		lowerAll(names),
+	)
+}
+
+func inCollection(query *gorm.DB, collectionID uint) *gorm.DB {
+	return query.Where(
+		"EXISTS (SELECT 1 FROM product_collections WHERE product_collections.product_id = products.id AND product_collections.collection_id = ?)",
+		collectionID,
+	)
+}
+
+func GetMyTags(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var tags []models.Tag
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("name").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
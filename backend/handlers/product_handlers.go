@@ -1,16 +1,17 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
-	"path/filepath"
 	"strconv"
-	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
-	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CreateProduct(c *gin.Context) {
@@ -19,20 +20,18 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
+	if !limitImageUploads(c) {
+		return
+	}
 
-	canCreate, plan, currentCount, err := CheckProductLimit(ownerID)
+	// Fail fast before storing any upload; the check is repeated under lock below.
+	canCreate, plan, currentCount, err := productLimitHint(database.DB, ownerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
 		return
 	}
 	if !canCreate {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":            "Product limit reached",
-			"limit":            plan.MaxProducts,
-			"current_count":    currentCount,
-			"plan_name":        plan.DisplayName,
-			"upgrade_required": true,
-		})
+		respondPlanLimit(c, "Product limit reached", plan.MaxProducts, plan, currentCount)
 		return
 	}
 
@@ -41,125 +40,309 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
 		return
 	}
+	input.SKU = normalizeSKU(input.SKU)
+	if input.StockQuantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+		return
+	}
 
-	// Handle multiple images
-	form, _ := c.MultipartForm()
-	var uploadedImages []string
-
-	if form != nil && form.File["images"] != nil {
-		files := form.File["images"]
-		for _, file := range files {
-			baseFilename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), strconv.Itoa(len(uploadedImages)))
-			jpgFilename := baseFilename + ".jpg"
-			jpgPath := filepath.Join("uploads", jpgFilename)
-
-			if err := utils.SaveCompressedImage(file, jpgPath); err == nil {
-				uploadedImages = append(uploadedImages, "/uploads/"+jpgFilename)
-			} else {
-				ext := filepath.Ext(file.Filename)
-				filename := baseFilename + ext
-				path := filepath.Join("uploads", filename)
-
-				if err := c.SaveUploadedFile(file, path); err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save image"})
-					return
-				}
-				uploadedImages = append(uploadedImages, "/uploads/"+filename)
-			}
-		}
+	options, err := bindProductOptionsAndVariants(c, &input.Options, &input.Variants)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	if _, err := bindJSONFormField(c, "attributes", &input.Attributes); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	attributes, err := buildProductAttributes(input.Attributes)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	saleUnit, err := normalizeSaleUnit(input.SaleUnit)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	minOrderQuantity := 1.0
+	if input.MinOrderQuantity != nil {
+		minOrderQuantity = *input.MinOrderQuantity
+	}
+	if err := validateQuantity("min_order_quantity", minOrderQuantity, saleUnit); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	if _, err := bindJSONFormField(c, "price_tiers", &input.PriceTiers); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	priceTiers, err := buildPriceTiers(input.PriceTiers, saleUnit)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	if _, err := bindJSONFormField(c, "modifier_groups", &input.ModifierGroups); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	modifierGroups, err := buildModifierGroups(input.ModifierGroups)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	collectionIDs, _ := requestedCollectionIDs(input.CollectionID, input.CollectionIDs)
+	tagNames, err := normalizeTagNames(input.Tags)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
 	}
 
-	if len(uploadedImages) == 0 {
-		file, err := c.FormFile("image")
-		if err == nil {
-			baseFilename := fmt.Sprintf("%d", time.Now().UnixNano())
-			jpgFilename := baseFilename + ".jpg"
-			jpgPath := filepath.Join("uploads", jpgFilename)
-
-			if err := utils.SaveCompressedImage(file, jpgPath); err == nil {
-				uploadedImages = append(uploadedImages, "/uploads/"+jpgFilename)
-			} else {
-				ext := filepath.Ext(file.Filename)
-				filename := baseFilename + ext
-				path := filepath.Join("uploads", filename)
-
-				if err := c.SaveUploadedFile(file, path); err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save image"})
-					return
-				}
-				uploadedImages = append(uploadedImages, "/uploads/"+filename)
-			}
+	status, err := normalizeProductStatus(input.Status)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	productType, err := normalizeProductType(input.Type)
+	if err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	if _, err := bindJSONFormField(c, "bundle_items", &input.BundleItems); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	if productType == models.ProductTypeBundle {
+		if len(input.Variants) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle cannot have variants"})
+			return
+		}
+		if input.TrackStock || input.StockQuantity > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle takes its stock from its products"})
+			return
 		}
+	} else if len(input.BundleItems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only bundles can have bundle_items"})
+		return
 	}
 
-	if input.CollectionID != nil {
-		var collection models.Collection
-		if err := database.DB.Where("id = ? AND owner_id = ?", *input.CollectionID, ownerID).First(&collection).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection_id"})
+	product := models.Product{
+		OwnerID:     ownerID,
+		Type:        productType,
+		SKU:         input.SKU,
+		Name:        input.Name,
+		Description: input.Description,
+		Price:       input.Price,
+		Status:      status,
+
+		TrackStock:        input.TrackStock,
+		AllowBackorder:    input.AllowBackorder,
+		LowStockThreshold: input.LowStockThreshold,
+		SaleUnit:          saleUnit,
+		MinOrderQuantity:  minOrderQuantity,
+	}
+
+	location, err := ownerLocation(database.DB, ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create product"})
+		return
+	}
+	compareAt := models.NullablePrice{Sent: input.CompareAtPrice != nil, Value: input.CompareAtPrice}
+	salePrice := models.NullablePrice{Sent: input.SalePrice != nil, Value: input.SalePrice}
+	if err := applyPricingInput(&product, location, compareAt, salePrice, input.SaleStartsAt, input.SaleEndsAt); err != nil {
+		respondValidationError(c, err, "Invalid data")
+		return
+	}
+	if input.PublishAt != nil {
+		if product.PublishAt, err = parseStoreTime("publish_at", *input.PublishAt, location, false); err != nil {
+			respondValidationError(c, err, "Invalid data")
 			return
 		}
 	}
 
-	var mainImageURL *string
-	if len(uploadedImages) > 0 {
-		mainImageURL = &uploadedImages[0]
+	uploadedImages, renditions, err := saveProductImages(c)
+	if err != nil {
+		respondValidationError(c, err, "Could not save image")
+		return
 	}
 
-	product := models.Product{
-		OwnerID:      ownerID,
-		CollectionID: input.CollectionID,
-		Name:         input.Name,
-		Description:  input.Description,
-		Price:        input.Price,
-		ImageURL:     mainImageURL,
+	if len(uploadedImages) > 0 {
+		product.ImageURL = &uploadedImages[0]
 	}
 
-	if err := database.DB.Create(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create product"})
-		return
-	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		allowed, lockedPlan, count, err := CheckProductLimit(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		plan, currentCount = lockedPlan, count
+		if !allowed {
+			return errPlanLimitReached
+		}
+
+		if err := ensureSKUsAvailable(tx, ownerID, 0, input.SKU, input.Variants); err != nil {
+			return err
+		}
+		if err := ensureOwnedCollections(tx, ownerID, collectionIDs); err != nil {
+			return err
+		}
+		if err := validateAttributeSchemas(tx, collectionIDs, attributes); err != nil {
+			return err
+		}
+		var bundleItems []models.BundleItem
+		if productType == models.ProductTypeBundle {
+			if bundleItems, err = buildBundleItems(tx, ownerID, 0, input.BundleItems); err != nil {
+				return err
+			}
+		}
 
-	for i, imgURL := range uploadedImages {
-		productImage := models.ProductImage{
-			ProductID: product.ID,
-			ImageURL:  imgURL,
-			Position:  i,
+		if err := tx.Omit(clause.Associations).Create(&product).Error; err != nil {
+			return err
+		}
+		if err := replaceBundleItems(tx, product.ID, bundleItems); err != nil {
+			return err
+		}
+		if err := replaceProductCollections(tx, product.ID, collectionIDs); err != nil {
+			return err
+		}
+		if err := replaceProductTags(tx, &product, tagNames); err != nil {
+			return err
+		}
+		if err := replaceProductAttributes(tx, product.ID, attributes); err != nil {
+			return err
 		}
-		database.DB.Create(&productImage)
+		if err := replacePriceTiers(tx, product.ID, priceTiers); err != nil {
+			return err
+		}
+		if err := replaceModifierGroups(tx, product.ID, modifierGroups); err != nil {
+			return err
+		}
+
+		imageIDs := make([]uint, 0, len(uploadedImages))
+		for i, imgURL := range uploadedImages {
+			productImage := models.ProductImage{
+				ProductID:  product.ID,
+				ImageURL:   imgURL,
+				Renditions: renditions[imgURL],
+				Position:   i,
+			}
+			if err := tx.Create(&productImage).Error; err != nil {
+				return err
+			}
+			imageIDs = append(imageIDs, productImage.ID)
+		}
+
+		if err := replaceProductOptions(tx, product.ID, options); err != nil {
+			return err
+		}
+		if err := replaceProductVariants(tx, &product, ownerID, input.Variants, imageIDs); err != nil {
+			return err
+		}
+
+		if len(input.Variants) > 0 || input.StockQuantity == 0 {
+			return nil
+		}
+		return applyStockChange(tx, stockChange{
+			Product: &product,
+			UserID:  ownerID,
+			After:   input.StockQuantity,
+			Reason:  models.StockReasonInitial,
+		})
+	})
+	if err != nil {
+		removeUploadedFiles(uploadedImages)
+		if errors.Is(err, errPlanLimitReached) {
+			respondPlanLimit(c, "Product limit reached", plan.MaxProducts, plan, currentCount)
+			return
+		}
+		respondValidationError(c, err, "Could not create product")
+		return
 	}
 
-	database.DB.Preload("Images").First(&product, product.ID)
+	withProductDetails(database.DB).First(&product, product.ID)
 
 	c.JSON(http.StatusCreated, product)
 }
 
+func orderByPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position asc")
+}
+
+// withProductDetails preloads everything a product response embeds.
+func withProductDetails(db *gorm.DB) *gorm.DB {
+	return withModifierGroups(withBundleItems(db)).Preload("Images", orderByPosition).
+		Preload("Options", orderByPosition).
+		Preload("Variants", orderByPosition).
+		Preload("Attributes", orderByPosition).
+		Preload("PriceTiers", orderByMinQuantity).
+		Preload("CollectionLinks", liveCollectionLinks).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("tags.name asc") })
+}
+
+// withPublicProductDetails is withProductDetails for shared catalogs and the
+// public listing. Responses must go through publicBundleComponents.
+func withPublicProductDetails(db *gorm.DB) *gorm.DB {
+	return withPublicBundleItems(withProductDetails(db))
+}
+
+// liveCollectionLinks leaves out links to collections that are in the trash;
+// they are kept so that restoring the collection brings them back.
+func liveCollectionLinks(db *gorm.DB) *gorm.DB {
+	return db.Where("collection_id IN (SELECT id FROM collections WHERE deleted_at IS NULL)")
+}
+
+// bindProductOptionsAndVariants fills options and variants from multipart
+// fields when present and validates them against each other.
+func bindProductOptionsAndVariants(c *gin.Context, optionInputs *[]models.ProductOptionInput, variantInputs *[]models.ProductVariantInput) ([]models.ProductOption, error) {
+	if _, err := bindJSONFormField(c, "options", optionInputs); err != nil {
+		return nil, err
+	}
+	if _, err := bindJSONFormField(c, "variants", variantInputs); err != nil {
+		return nil, err
+	}
+
+	options, err := buildProductOptions(*optionInputs)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateVariantOptions(options, variantSelections(*variantInputs)); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func removeUploadedFiles(urls []string) {
+	for _, url := range urls {
+		key := storage.Key(url)
+		storage.Uploads.Delete(context.Background(), key)
+		removeStoredRenditions(key)
+	}
+}
+
 func GetProducts(c *gin.Context) {
-	var products []models.Product
+	params, err := parseProductListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	query := database.DB.Model(&models.Product{}).Preload("Images")
+	query := publiclyVisible(database.DB)
 	if ownerIDRaw := c.Query("owner_id"); ownerIDRaw != "" {
 		ownerIDParsed, err := strconv.ParseUint(ownerIDRaw, 10, 64)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner_id"})
 			return
 		}
-		query = query.Where("owner_id = ?", uint(ownerIDParsed))
-	}
-	if collectionIDRaw := c.Query("collection_id"); collectionIDRaw != "" {
-		collectionIDParsed, err := strconv.ParseUint(collectionIDRaw, 10, 64)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection_id"})
-			return
-		}
-		query = query.Where("collection_id = ?", uint(collectionIDParsed))
+		query = query.Where("products.owner_id = ?", uint(ownerIDParsed))
 	}
 
-	if err := query.Order("created_at desc").Find(&products).Error; err != nil {
+	response, err := listProducts(query, params, true)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, response)
 }
 
 func GetMyProducts(c *gin.Context) {
@@ -169,13 +352,19 @@ func GetMyProducts(c *gin.Context) {
 		return
 	}
 
-	var products []models.Product
-	if err := database.DB.Preload("Images").Where("owner_id = ?", ownerID).Order("created_at desc").Find(&products).Error; err != nil {
+	params, err := parseProductListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := listProducts(database.DB.Where("products.owner_id = ?", ownerID), params, false)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, response)
 }
 
 func UpdateProduct(c *gin.Context) {
@@ -190,89 +379,155 @@ func UpdateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
 		return
 	}
+	if !limitImageUploads(c) {
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
 
 	var input models.UpdateProductInput
 	if err := c.ShouldBind(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
 		return
 	}
+	// An empty multipart tags field clears the tags, as [] does in JSON.
+	if _, sent := c.GetPostFormArray("tags"); sent && input.Tags == nil {
+		input.Tags = []string{}
+	}
 
-	deleteImageIDsStr := c.PostFormArray("delete_image_ids")
-	var deleteImageIDs []uint
-	for _, idStr := range deleteImageIDsStr {
-		imgID, err := strconv.ParseUint(idStr, 10, 64)
-		if err == nil {
-			deleteImageIDs = append(deleteImageIDs, uint(imgID))
+	options, err := resolveUpdatedOptions(c, product.ID, &input)
+	if err != nil {
+		respondValidationError(c, err, "Could not update product")
+		return
+	}
+	if _, err := bindJSONFormField(c, "attributes", &input.Attributes); err != nil {
+		respondValidationError(c, err, "Could not update product")
+		return
+	}
+	var attributes []models.ProductAttribute
+	if input.Attributes != nil {
+		if attributes, err = buildProductAttributes(*input.Attributes); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
 		}
 	}
-
-	if len(deleteImageIDs) > 0 {
-		database.DB.Where("id IN ? AND product_id = ?", deleteImageIDs, uint(id)).Delete(&models.ProductImage{})
+	saleUnit := product.SaleUnit
+	if input.SaleUnit != nil {
+		if saleUnit, err = normalizeSaleUnit(*input.SaleUnit); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
+		}
+	}
+	if input.MinOrderQuantity != nil || input.SaleUnit != nil {
+		minOrderQuantity := product.MinOrderQuantity
+		if input.MinOrderQuantity != nil {
+			minOrderQuantity = *input.MinOrderQuantity
+		}
+		if err := validateQuantity("min_order_quantity", minOrderQuantity, saleUnit); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
+		}
+	}
+	if _, err := bindJSONFormField(c, "price_tiers", &input.PriceTiers); err != nil {
+		respondValidationError(c, err, "Could not update product")
+		return
+	}
+	var priceTiers []models.PriceTier
+	if input.PriceTiers != nil {
+		if priceTiers, err = buildPriceTiers(*input.PriceTiers, saleUnit); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
+		}
+	}
+	if _, err := bindJSONFormField(c, "modifier_groups", &input.ModifierGroups); err != nil {
+		respondValidationError(c, err, "Could not update product")
+		return
+	}
+	var modifierGroups []models.ModifierGroup
+	if input.ModifierGroups != nil {
+		if modifierGroups, err = buildModifierGroups(*input.ModifierGroups); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
+		}
+	}
+	if _, err := bindJSONFormField(c, "bundle_items", &input.BundleItems); err != nil {
+		respondValidationError(c, err, "Could not update product")
+		return
+	}
+	if product.Type == models.ProductTypeBundle {
+		if input.Variants != nil && len(*input.Variants) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle cannot have variants"})
+			return
+		}
+		if (input.TrackStock != nil && *input.TrackStock) || input.StockQuantity != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle takes its stock from its products"})
+			return
+		}
+	} else if input.BundleItems != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only bundles can have bundle_items"})
+		return
+	}
+	collectionIDs, collectionsChanged := requestedCollectionIDs(input.CollectionID, input.CollectionIDs)
+	tagNames, err := normalizeTagNames(input.Tags)
+	if err != nil {
+		respondValidationError(c, err, "Could not update product")
+		return
 	}
 
-	form, _ := c.MultipartForm()
-	var uploadedImages []string
-
-	if form != nil && form.File["images"] != nil {
-		files := form.File["images"]
-		for i, file := range files {
-			baseFilename := fmt.Sprintf("%d_%d", time.Now().UnixNano(), i)
-			jpgFilename := baseFilename + ".jpg"
-			jpgPath := filepath.Join("uploads", jpgFilename)
-
-			if err := utils.SaveCompressedImage(file, jpgPath); err == nil {
-				uploadedImages = append(uploadedImages, "/uploads/"+jpgFilename)
-			} else {
-				// Fallback
-				ext := filepath.Ext(file.Filename)
-				filename := baseFilename + ext
-				path := filepath.Join("uploads", filename)
-
-				if err := c.SaveUploadedFile(file, path); err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save image"})
-					return
-				}
-				uploadedImages = append(uploadedImages, "/uploads/"+filename)
+	// A new price can invalidate a stored sale price, so both are checked together.
+	priced := product
+	if input.Price != nil {
+		priced.Price = *input.Price
+	}
+	if input.Price != nil || input.PublishAt != nil || pricingChanged(input.CompareAtPrice, input.SalePrice, input.SaleStartsAt, input.SaleEndsAt) {
+		location, err := ownerLocation(database.DB, ownerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update product"})
+			return
+		}
+		if err := applyPricingInput(&priced, location, input.CompareAtPrice, input.SalePrice, input.SaleStartsAt, input.SaleEndsAt); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
+		}
+		if input.PublishAt != nil {
+			if priced.PublishAt, err = parseStoreTime("publish_at", *input.PublishAt, location, false); err != nil {
+				respondValidationError(c, err, "Could not update product")
+				return
 			}
 		}
 	}
+	status := product.Status
+	if input.Status != nil {
+		if status, err = normalizeProductStatus(*input.Status); err != nil {
+			respondValidationError(c, err, "Could not update product")
+			return
+		}
+	}
 
-	if len(uploadedImages) == 0 {
-		file, err := c.FormFile("image")
+	deleteImageIDsStr := c.PostFormArray("delete_image_ids")
+	var deleteImageIDs []uint
+	for _, idStr := range deleteImageIDsStr {
+		imgID, err := strconv.ParseUint(idStr, 10, 64)
 		if err == nil {
-			baseFilename := fmt.Sprintf("%d", time.Now().UnixNano())
-			jpgFilename := baseFilename + ".jpg"
-			jpgPath := filepath.Join("uploads", jpgFilename)
-
-			if err := utils.SaveCompressedImage(file, jpgPath); err == nil {
-				uploadedImages = append(uploadedImages, "/uploads/"+jpgFilename)
-			} else {
-				// Fallback
-				ext := filepath.Ext(file.Filename)
-				filename := baseFilename + ext
-				path := filepath.Join("uploads", filename)
-
-				if err := c.SaveUploadedFile(file, path); err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save image"})
-					return
-				}
-				uploadedImages = append(uploadedImages, "/uploads/"+filename)
-			}
+			deleteImageIDs = append(deleteImageIDs, uint(imgID))
 		}
 	}
 
-	var maxPosition int
-	database.DB.Model(&models.ProductImage{}).Where("product_id = ?", uint(id)).Select("COALESCE(MAX(position), -1)").Scan(&maxPosition)
-
-	for i, imgURL := range uploadedImages {
-		productImage := models.ProductImage{
-			ProductID: uint(id),
-			ImageURL:  imgURL,
-			Position:  maxPosition + 1 + i,
-		}
-		database.DB.Create(&productImage)
+	uploadedImages, renditions, err := saveProductImages(c)
+	if err != nil {
+		respondValidationError(c, err, "Could not save image")
+		return
 	}
 
+	productSKU := product.SKU
 	updates := map[string]any{}
 	if input.Name != nil {
 		updates["name"] = *input.Name
@@ -283,31 +538,238 @@ func UpdateProduct(c *gin.Context) {
 	if input.Price != nil {
 		updates["price"] = *input.Price
 	}
-	if input.CollectionID != nil {
-		updates["collection_id"] = *input.CollectionID
+	if input.SKU != nil {
+		productSKU = normalizeSKU(input.SKU)
+		updates["sku"] = productSKU
 	}
-
-	var firstImage models.ProductImage
-	if err := database.DB.Where("product_id = ?", uint(id)).Order("position asc").First(&firstImage).Error; err == nil {
-		updates["image_url"] = firstImage.ImageURL
+	if pricingChanged(input.CompareAtPrice, input.SalePrice, input.SaleStartsAt, input.SaleEndsAt) {
+		updates["compare_at_price"] = priced.CompareAtPrice
+		updates["sale_price"] = priced.SalePrice
+		updates["sale_starts_at"] = priced.SaleStartsAt
+		updates["sale_ends_at"] = priced.SaleEndsAt
+	}
+	if input.Status != nil {
+		updates["status"] = status
+	}
+	if input.PublishAt != nil {
+		updates["publish_at"] = priced.PublishAt
+	}
+	if input.TrackStock != nil {
+		updates["track_stock"] = *input.TrackStock
+	}
+	if input.AllowBackorder != nil {
+		updates["allow_backorder"] = *input.AllowBackorder
+	}
+	if input.SaleUnit != nil {
+		updates["sale_unit"] = saleUnit
+	}
+	if input.MinOrderQuantity != nil {
+		updates["min_order_quantity"] = *input.MinOrderQuantity
+	}
+	if input.LowStockThreshold != nil {
+		if *input.LowStockThreshold < 0 {
+			updates["low_stock_threshold"] = nil
+		} else {
+			updates["low_stock_threshold"] = *input.LowStockThreshold
+		}
 	}
 
-	if len(updates) > 0 {
-		result := database.DB.Model(&models.Product{}).
-			Where("id = ? AND owner_id = ?", uint(id), ownerID).
-			Updates(updates)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update product"})
+	// Archived products are outside the plan quota, so bringing one back
+	// needs room for it.
+	var plan *models.Plan
+	var currentCount int
+	// Files of removed images are deleted only once the change is committed.
+	var removedImages []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// The status is read again under a row lock, so that a concurrent
+		// change cannot bring the product back without a quota check.
+		var locked models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status").
+			Where("id = ? AND owner_id = ?", product.ID, ownerID).
+			First(&locked).Error; err != nil {
+			return err
+		}
+		newStatus := locked.Status
+		if input.Status != nil {
+			newStatus = status
+		}
+
+		before, err := productSnapshot(tx, product.ID)
+		if err != nil {
+			return err
+		}
+
+		if locked.Status == models.ProductStatusArchived && newStatus != models.ProductStatusArchived {
+			allowed, lockedPlan, count, err := CheckProductLimit(tx, ownerID)
+			if err != nil {
+				return err
+			}
+			plan, currentCount = lockedPlan, count
+			if !allowed {
+				return errPlanLimitReached
+			}
+		}
+
+		var variantInputs []models.ProductVariantInput
+		if input.Variants != nil {
+			variantInputs = *input.Variants
+		}
+		if err := ensureSKUsAvailable(tx, ownerID, product.ID, productSKU, variantInputs); err != nil {
+			return err
+		}
+		if len(variantInputs) > 0 {
+			var conflict *bundleConflictError
+			if err := ensureNotInBundles(tx, []uint{product.ID}); errors.As(err, &conflict) {
+				return newValidationError("Products inside bundles cannot have variants")
+			} else if err != nil {
+				return err
+			}
+		}
+		if input.BundleItems != nil {
+			bundleItems, err := buildBundleItems(tx, ownerID, product.ID, *input.BundleItems)
+			if err != nil {
+				return err
+			}
+			if err := replaceBundleItems(tx, product.ID, bundleItems); err != nil {
+				return err
+			}
+		}
+		if collectionsChanged {
+			if err := ensureOwnedCollections(tx, ownerID, collectionIDs); err != nil {
+				return err
+			}
+			if err := replaceProductCollections(tx, product.ID, collectionIDs); err != nil {
+				return err
+			}
+		}
+		if input.Tags != nil {
+			if err := replaceProductTags(tx, &product, tagNames); err != nil {
+				return err
+			}
+		}
+		if input.PriceTiers != nil {
+			if err := replacePriceTiers(tx, product.ID, priceTiers); err != nil {
+				return err
+			}
+		} else if saleUnit != product.SaleUnit {
+			if err := ensureTiersFitSaleUnit(tx, product.ID, saleUnit); err != nil {
+				return err
+			}
+		}
+		if input.ModifierGroups != nil {
+			if err := replaceModifierGroups(tx, product.ID, modifierGroups); err != nil {
+				return err
+			}
+		}
+		if input.Attributes != nil || collectionsChanged {
+			if err := updateProductAttributes(tx, product.ID, attributes, input.Attributes != nil); err != nil {
+				return err
+			}
+		}
+
+		if len(deleteImageIDs) > 0 {
+			if err := tx.Model(&models.ProductImage{}).Where("id IN ? AND product_id = ?", deleteImageIDs, product.ID).Pluck("image_url", &removedImages).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.ProductVariant{}).Where("product_id = ? AND image_id IN ?", product.ID, deleteImageIDs).Update("image_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ? AND product_id = ?", deleteImageIDs, product.ID).Delete(&models.ProductImage{}).Error; err != nil {
+				return err
+			}
+		}
+
+		var maxPosition int
+		tx.Model(&models.ProductImage{}).Where("product_id = ?", product.ID).Select("COALESCE(MAX(position), -1)").Scan(&maxPosition)
+
+		imageIDs := make([]uint, 0, len(uploadedImages))
+		for i, imgURL := range uploadedImages {
+			productImage := models.ProductImage{
+				ProductID:  product.ID,
+				ImageURL:   imgURL,
+				Renditions: renditions[imgURL],
+				Position:   maxPosition + 1 + i,
+			}
+			if err := tx.Create(&productImage).Error; err != nil {
+				return err
+			}
+			imageIDs = append(imageIDs, productImage.ID)
+		}
+
+		var firstImage models.ProductImage
+		if err := tx.Where("product_id = ?", product.ID).Order("position asc").First(&firstImage).Error; err == nil {
+			updates["image_url"] = firstImage.ImageURL
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&product).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, product.ID).Error; err != nil {
+			return err
+		}
+
+		if input.Options != nil {
+			if err := replaceProductOptions(tx, product.ID, options); err != nil {
+				return err
+			}
+		}
+		if input.Variants != nil {
+			if err := replaceProductVariants(tx, &product, ownerID, variantInputs, imageIDs); err != nil {
+				return err
+			}
+		}
+
+		after, err := productSnapshot(tx, product.ID)
+		if err != nil {
+			return err
+		}
+		revision := models.Revision{OwnerID: ownerID, UserID: ownerID, EntityType: models.RevisionEntityProduct, EntityID: product.ID}
+		if err := recordRevision(tx, revision, before, after); err != nil {
+			return err
+		}
+
+		if input.StockQuantity == nil {
+			return nil
+		}
+		if *input.StockQuantity < 0 {
+			return newValidationError("Stock cannot be negative")
+		}
+		var variantCount int64
+		if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&variantCount).Error; err != nil {
+			return err
+		}
+		if variantCount > 0 {
+			return newValidationError("Set stock on each variant for products with variants")
+		}
+		return applyStockChange(tx, stockChange{
+			Product: &product,
+			UserID:  ownerID,
+			Before:  product.StockQuantity,
+			After:   *input.StockQuantity,
+			Reason:  models.StockReasonAdjustment,
+			Note:    input.StockNote,
+		})
+	})
+	if err != nil {
+		removeUploadedFiles(uploadedImages)
+		if errors.Is(err, errPlanLimitReached) {
+			respondPlanLimit(c, "Product limit reached", plan.MaxProducts, plan, currentCount)
 			return
 		}
-		if result.RowsAffected == 0 {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
+		respondValidationError(c, err, "Could not update product")
+		return
 	}
+	removeUploadedFiles(removedImages)
 
 	var updated models.Product
-	if err := database.DB.Preload("Images").Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&updated).Error; err != nil {
+	if err := withProductDetails(database.DB).Where("id = ? AND owner_id = ?", product.ID, ownerID).First(&updated).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve updated product"})
 		return
 	}
@@ -315,6 +777,45 @@ func UpdateProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, updated)
 }
 
+// resolveUpdatedOptions binds the optional options and variants of an update
+// and checks the resulting combination, falling back to the stored set for
+// whichever side the request leaves out.
+func resolveUpdatedOptions(c *gin.Context, productID uint, input *models.UpdateProductInput) ([]models.ProductOption, error) {
+	if _, err := bindJSONFormField(c, "options", &input.Options); err != nil {
+		return nil, err
+	}
+	if _, err := bindJSONFormField(c, "variants", &input.Variants); err != nil {
+		return nil, err
+	}
+	if input.Options == nil && input.Variants == nil {
+		return nil, nil
+	}
+
+	var options []models.ProductOption
+	if input.Options != nil {
+		built, err := buildProductOptions(*input.Options)
+		if err != nil {
+			return nil, err
+		}
+		options = built
+	} else if err := database.DB.Where("product_id = ?", productID).Order("position asc").Find(&options).Error; err != nil {
+		return nil, err
+	}
+
+	var selections []map[string]string
+	if input.Variants != nil {
+		selections = variantSelections(*input.Variants)
+	} else {
+		var variants []models.ProductVariant
+		if err := database.DB.Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+			return nil, err
+		}
+		selections = storedVariantSelections(variants)
+	}
+
+	return options, validateVariantOptions(options, selections)
+}
+
 func DeleteProduct(c *gin.Context) {
 	ownerID, ok := getUserIDFromContext(c)
 	if !ok {
@@ -328,15 +829,30 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	database.DB.Where("product_id = ?", uint(id)).Delete(&models.ProductImage{})
-
-	result := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).Delete(&models.Product{})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete product"})
-		return
-	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	// Products go to the trash first; images stay until the product is purged.
+	// Products that bundles still contain have to be taken out of them first.
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", uint(id), ownerID).
+			First(&product).Error; err != nil {
+			return err
+		}
+		if err := ensureNotInBundles(tx, []uint{product.ID}); err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
+		var conflict *bundleConflictError
+		switch {
+		case errors.As(err, &conflict):
+			respondBundleConflict(c, conflict)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete product"})
+		}
 		return
 	}
 
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxImagesPerRequest    = 10
+	maxImageAltTextLength  = 250
+	maxImageCaptionLength  = 500
+	renditionBackfillBatch = 50
+	// renditionBackfillLock is the advisory lock key held while the
+	// backfill runs.
+	renditionBackfillLock = 470047
+)
+
+var errImageNotFound = errors.New("image not found")
+
+// limitImageUploads caps the size of a product request before its body is
+// read, and the number of files a multipart one carries. It answers the
+// request itself and returns false when either is exceeded.
+func limitImageUploads(c *gin.Context) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImagesPerRequest*utils.MaxImageBytes+1<<20)
+	if c.ContentType() != "multipart/form-data" {
+		return true
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Requests can carry at most %d MB", tooLarge.Limit>>20)})
+			return false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return false
+	}
+	if files := len(form.File["images"]) + len(form.File["image"]); files > maxImagesPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d images can be sent at once", maxImagesPerRequest)})
+		return false
+	}
+	return true
+}
+
+// saveProductImages stores the files of the "images" form field, or the
+// single "image" field when there are none, and returns their URLs with the
+// renditions made for each.
+func saveProductImages(c *gin.Context) ([]string, map[string][]models.ImageRendition, error) {
+	var files []*multipart.FileHeader
+	if form, _ := c.MultipartForm(); form != nil {
+		files = form.File["images"]
+	}
+	if len(files) == 0 {
+		if file, err := c.FormFile("image"); err == nil {
+			files = []*multipart.FileHeader{file}
+		}
+	}
+
+	uploaded := make([]string, 0, len(files))
+	renditions := make(map[string][]models.ImageRendition, len(files))
+	for i, file := range files {
+		url, imageRenditions, err := saveProductImage(c, file, fmt.Sprintf("%d_%d", time.Now().UnixNano(), i))
+		if err != nil {
+			removeUploadedFiles(uploaded)
+			return nil, nil, err
+		}
+		uploaded = append(uploaded, url)
+		renditions[url] = imageRenditions
+	}
+	return uploaded, renditions, nil
+}
+
+// saveProductImage stores an upload as a compressed JPEG with its
+// renditions. Files that are not a JPEG or PNG within the upload limits are
+// rejected with a validation error.
+func saveProductImage(c *gin.Context, file *multipart.FileHeader, baseFilename string) (string, []models.ImageRendition, error) {
+	ctx := c.Request.Context()
+	data, err := readUpload(file)
+	if err == nil {
+		var img image.Image
+		if img, err = utils.DecodeImage(data); err == nil {
+			return storeProductImage(ctx, baseFilename+".jpg", img, utils.ColorProfile(data))
+		}
+	}
+	var rejected *utils.ImageError
+	if errors.As(err, &rejected) {
+		return "", nil, newValidationError("%s: %s", file.Filename, rejected.Error())
+	}
+	return "", nil, err
+}
+
+func storeProductImage(ctx context.Context, key string, img image.Image, profile []byte) (string, []models.ImageRendition, error) {
+	compressed, err := utils.EncodeJPEG(img, profile)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := storage.Uploads.Put(ctx, key, compressed, "image/jpeg"); err != nil {
+		return "", nil, err
+	}
+	return storage.Uploads.URL(key), createImageRenditions(ctx, key, img, profile), nil
+}
+
+func readUpload(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return utils.ReadImage(src)
+}
+
+// createImageRenditions stores the renditions of the image saved as key.
+// Failures are logged and leave the image without renditions.
+func createImageRenditions(ctx context.Context, key string, img image.Image, profile []byte) []models.ImageRendition {
+	created, err := utils.CreateRenditions(img, profile)
+	if err != nil {
+		log.Printf("renditions of %s: %v", key, err)
+		return nil
+	}
+	renditions := make([]models.ImageRendition, len(created))
+	for i, rendition := range created {
+		renditionKey := utils.RenditionKey(key, rendition.Name, rendition.Format)
+		if err := storage.Uploads.Put(ctx, renditionKey, rendition.Data, storage.ContentType(renditionKey)); err != nil {
+			log.Printf("renditions of %s: %v", key, err)
+			removeStoredRenditions(key)
+			return nil
+		}
+		renditions[i] = models.ImageRendition{
+			Name:   rendition.Name,
+			Format: rendition.Format,
+			Width:  rendition.Width,
+			Height: rendition.Height,
+			URL:    storage.Uploads.URL(renditionKey),
+		}
+	}
+	return renditions
+}
+
+func removeStoredRenditions(key string) {
+	for _, renditionKey := range utils.RenditionKeys(key) {
+		storage.Uploads.Delete(context.Background(), renditionKey)
+	}
+}
+
+// StartRenditionBackfill makes renditions for images uploaded before they
+// existed, in the background and in batches, once per startup. A Postgres
+// advisory lock keeps replicas that start together from doing the same
+// work; the others skip it.
+func StartRenditionBackfill() {
+	go func() {
+		err := database.DB.Connection(func(conn *gorm.DB) error {
+			var locked bool
+			if err := conn.Raw("SELECT pg_try_advisory_lock(?)", renditionBackfillLock).Scan(&locked).Error; err != nil {
+				return err
+			}
+			if !locked {
+				return nil
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", renditionBackfillLock)
+			backfillRenditions()
+			return nil
+		})
+		if err != nil {
+			log.Printf("rendition backfill: %v", err)
+		}
+	}()
+}
+
+func backfillRenditions() {
+	var lastID uint
+	for {
+		var images []models.ProductImage
+		if err := database.DB.Where("renditions IS NULL AND id > ?", lastID).Order("id asc").Limit(renditionBackfillBatch).Find(&images).Error; err != nil {
+			log.Printf("rendition backfill: %v", err)
+			return
+		}
+		if len(images) == 0 {
+			return
+		}
+		for i := range images {
+			lastID = images[i].ID
+			key := storage.Key(images[i].ImageURL)
+			data, err := storage.Uploads.Get(context.Background(), key)
+			if err != nil {
+				log.Printf("rendition backfill: image %d: %v", images[i].ID, err)
+				continue
+			}
+			img, err := utils.DecodeImage(data)
+			if err != nil {
+				continue
+			}
+			images[i].Renditions = createImageRenditions(context.Background(), key, img, utils.ColorProfile(data))
+			if images[i].Renditions == nil {
+				continue
+			}
+			if err := database.DB.Model(&images[i]).Select("renditions").Updates(&images[i]).Error; err != nil {
+				log.Printf("rendition backfill: image %d: %v", images[i].ID, err)
+			}
+		}
+	}
+}
+
+// syncCoverImage keeps Product.ImageURL pointing at the first image.
+func syncCoverImage(tx *gorm.DB, productID uint) error {
+	var cover *string
+	var first models.ProductImage
+	err := tx.Where("product_id = ?", productID).Order("position asc, id asc").First(&first).Error
+	switch {
+	case err == nil:
+		cover = &first.ImageURL
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", productID).Update("image_url", cover).Error
+}
+
+// lockImageProduct locks the owner's product so image changes apply one after
+// the other.
+func lockImageProduct(tx *gorm.DB, ownerID, productID uint) error {
+	var product models.Product
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND owner_id = ?", productID, ownerID).
+		First(&product).Error
+}
+
+func findProductImage(tx *gorm.DB, productID, imageID uint) (*models.ProductImage, error) {
+	var image models.ProductImage
+	if err := tx.Where("id = ? AND product_id = ?", imageID, productID).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errImageNotFound
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+func imageRequestIDs(c *gin.Context, withImage bool) (ownerID, productID, imageID uint, ok bool) {
+	ownerID, ok = getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return 0, 0, 0, false
+	}
+	if !withImage {
+		return ownerID, uint(id), 0, true
+	}
+
+	image, err := strconv.ParseUint(c.Param("image_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image_id"})
+		return 0, 0, 0, false
+	}
+	return ownerID, uint(id), uint(image), true
+}
+
+// respondProductImages answers with the product's images in order, or with
+// the error of the change.
+func respondProductImages(c *gin.Context, productID uint, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		case errors.Is(err, errImageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		default:
+			respondValidationError(c, err, "Could not update images")
+		}
+		return
+	}
+
+	images := []models.ProductImage{}
+	if err := orderByPosition(database.DB.Where("product_id = ?", productID)).Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve images"})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+// moveImagesFirst renumbers the product's images with the given ones first,
+// in that order, and the others after them in their current order.
+func moveImagesFirst(tx *gorm.DB, productID uint, imageIDs []uint) error {
+	var current []models.ProductImage
+	if err := orderByPosition(tx.Where("product_id = ?", productID)).Find(&current).Error; err != nil {
+		return err
+	}
+
+	belongs := make(map[uint]bool, len(current))
+	for _, image := range current {
+		belongs[image.ID] = true
+	}
+	listed := make(map[uint]bool, len(imageIDs))
+	for _, id := range imageIDs {
+		if !belongs[id] {
+			return newValidationError("Image %d does not belong to this product", id)
+		}
+		if listed[id] {
+			return newValidationError("Image %d is listed more than once", id)
+		}
+		listed[id] = true
+	}
+
+	order := append([]uint{}, imageIDs...)
+	for _, image := range current {
+		if !listed[image.ID] {
+			order = append(order, image.ID)
+		}
+	}
+	for position, id := range order {
+		if err := tx.Model(&models.ProductImage{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+			return err
+		}
+	}
+	return syncCoverImage(tx, productID)
+}
+
+// ReorderProductImages stores a new image order. Images left out keep their
+// relative order after the listed ones, and the first image is the cover.
+func ReorderProductImages(c *gin.Context) {
+	ownerID, productID, _, ok := imageRequestIDs(c, false)
+	if !ok {
+		return
+	}
+
+	var input models.ReorderImagesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockImageProduct(tx, ownerID, productID); err != nil {
+			return err
+		}
+		return moveImagesFirst(tx, productID, input.ImageIDs)
+	})
+	respondProductImages(c, productID, err)
+}
+
+// SetCoverImage makes an image the cover by moving it to the front.
+func SetCoverImage(c *gin.Context) {
+	ownerID, productID, imageID, ok := imageRequestIDs(c, true)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockImageProduct(tx, ownerID, productID); err != nil {
+			return err
+		}
+		if _, err := findProductImage(tx, productID, imageID); err != nil {
+			return err
+		}
+		return moveImagesFirst(tx, productID, []uint{imageID})
+	})
+	respondProductImages(c, productID, err)
+}
+
+// UpdateProductImage sets the alt text and caption of an image.
+func UpdateProductImage(c *gin.Context) {
+	ownerID, productID, imageID, ok := imageRequestIDs(c, true)
+	if !ok {
+		return
+	}
+
+	var input models.UpdateProductImageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	updates := map[string]any{}
+	if input.AltText != nil {
+		if len([]rune(*input.AltText)) > maxImageAltTextLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alt_text can have at most %d characters", maxImageAltTextLength)})
+			return
+		}
+		updates["alt_text"] = *input.AltText
+	}
+	if input.Caption != nil {
+		if len([]rune(*input.Caption)) > maxImageCaptionLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("caption can have at most %d characters", maxImageCaptionLength)})
+			return
+		}
+		updates["caption"] = *input.Caption
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockImageProduct(tx, ownerID, productID); err != nil {
+			return err
+		}
+		image, err := findProductImage(tx, productID, imageID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(image).Updates(updates).Error
+	})
+	respondProductImages(c, productID, err)
+}
+
+// ReplaceProductImage swaps the file of an image for a new upload, keeping
+// its id, position, alt text, caption and the variants that use it.
+func ReplaceProductImage(c *gin.Context) {
+	ownerID, productID, imageID, ok := imageRequestIDs(c, true)
+	if !ok {
+		return
+	}
+
+	if !limitImageUploads(c) {
+		return
+	}
+	file, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image is required"})
+		return
+	}
+	url, renditions, err := saveProductImage(c, file, fmt.Sprintf("%d", time.Now().UnixNano()))
+	if err != nil {
+		respondValidationError(c, err, "Could not save image")
+		return
+	}
+
+	var previousURL string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockImageProduct(tx, ownerID, productID); err != nil {
+			return err
+		}
+		image, err := findProductImage(tx, productID, imageID)
+		if err != nil {
+			return err
+		}
+		previousURL = image.ImageURL
+
+		replaced := models.ProductImage{ImageURL: url, Renditions: renditions}
+		if err := tx.Model(image).Select("image_url", "renditions").Updates(&replaced).Error; err != nil {
+			return err
+		}
+		return syncCoverImage(tx, productID)
+	})
+	if err != nil {
+		removeUploadedFiles([]string{url})
+	} else {
+		removeUploadedFiles([]string{previousURL})
+	}
+	respondProductImages(c, productID, err)
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultProductPageSize = 50
+	maxProductPageSize     = 200
+)
+
+var productSortColumns = map[string]string{
+	"price":   "price",
+	"name":    "name",
+	"created": "created_at",
+	"updated": "updated_at",
+}
+
+type productListParams struct {
+	Limit         int
+	Sort          string
+	Desc          bool
+	Cursor        *productCursor
+	CollectionID  *uint
+	Uncategorized bool
+	MinPrice      *float64
+	MaxPrice      *float64
+	HasImages     *bool
+	Tags          []string
+	Status        string
+
+	// Attributes, AttributeMin and AttributeMax come from attr[key],
+	// attr_min[key] and attr_max[key].
+	Attributes   map[string]string
+	AttributeMin map[string]float64
+	AttributeMax map[string]float64
+}
+
+// productCursor points at the last row of a page: the sort key value plus the
+// id as a tie-breaker, so pages stay stable while rows are inserted.
+type productCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+type productListResponse struct {
+	Products   []models.Product `json:"products"`
+	Total      int64            `json:"total"`
+	NextCursor *string          `json:"next_cursor"`
+}
+
+type invalidParamError struct {
+	param string
+}
+
+func (e *invalidParamError) Error() string {
+	return "Invalid " + e.param
+}
+
+func parseProductListParams(c *gin.Context) (*productListParams, error) {
+	params := &productListParams{Limit: defaultProductPageSize, Sort: "created", Desc: true}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, &invalidParamError{"limit"}
+		}
+		if limit > maxProductPageSize {
+			limit = maxProductPageSize
+		}
+		params.Limit = limit
+	}
+
+	if raw := c.Query("sort"); raw != "" {
+		if _, ok := productSortColumns[raw]; !ok {
+			return nil, &invalidParamError{"sort"}
+		}
+		params.Sort = raw
+		params.Desc = params.Sort == "created" || params.Sort == "updated"
+	}
+
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		params.Desc = false
+	case "desc":
+		params.Desc = true
+	default:
+		return nil, &invalidParamError{"order"}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeProductCursor(raw)
+		if err != nil || cursor.Sort != params.Sort {
+			return nil, &invalidParamError{"cursor"}
+		}
+		params.Cursor = cursor
+		if _, err := params.cursorValue(); err != nil {
+			return nil, &invalidParamError{"cursor"}
+		}
+	}
+
+	if raw := c.Query("collection_id"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, &invalidParamError{"collection_id"}
+		}
+		collectionID := uint(parsed)
+		params.CollectionID = &collectionID
+	}
+
+	uncategorized, err := queryBool(c, "uncategorized")
+	if err != nil {
+		return nil, err
+	}
+	params.Uncategorized = uncategorized != nil && *uncategorized
+
+	if params.MinPrice, err = queryPrice(c, "min_price"); err != nil {
+		return nil, err
+	}
+	if params.MaxPrice, err = queryPrice(c, "max_price"); err != nil {
+		return nil, err
+	}
+	if params.HasImages, err = queryBool(c, "has_images"); err != nil {
+		return nil, err
+	}
+	params.Tags = c.QueryArray("tag")
+
+	if raw := c.Query("status"); raw != "" {
+		if !slices.Contains(models.ProductStatuses, raw) {
+			return nil, &invalidParamError{"status"}
+		}
+		params.Status = raw
+	}
+
+	params.Attributes = c.QueryMap("attr")
+	if params.AttributeMin, err = queryNumberMap(c, "attr_min"); err != nil {
+		return nil, err
+	}
+	if params.AttributeMax, err = queryNumberMap(c, "attr_max"); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func queryNumberMap(c *gin.Context, param string) (map[string]float64, error) {
+	raw := c.QueryMap(param)
+	values := make(map[string]float64, len(raw))
+	for key, value := range raw {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, &invalidParamError{param + "[" + key + "]"}
+		}
+		values[key] = number
+	}
+	return values, nil
+}
+
+func queryBool(c *gin.Context, param string) (*bool, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, &invalidParamError{param}
+	}
+	return &value, nil
+}
+
+func queryPrice(c *gin.Context, param string) (*float64, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 {
+		return nil, &invalidParamError{param}
+	}
+	return &value, nil
+}
+
+func (p *productListParams) applyFilters(query *gorm.DB) *gorm.DB {
+	if p.CollectionID != nil {
+		query = inCollection(query, *p.CollectionID)
+	}
+	if p.Uncategorized {
+		query = query.Where("NOT EXISTS (SELECT 1 FROM product_collections JOIN collections ON collections.id = product_collections.collection_id " +
+			"WHERE product_collections.product_id = products.id AND collections.deleted_at IS NULL)")
+	}
+	query = withTags(query, p.Tags)
+	if p.Status != "" {
+		query = query.Where("products.status = ?", p.Status)
+	}
+	if p.MinPrice != nil {
+		query = query.Where("products.price >= ?", *p.MinPrice)
+	}
+	if p.MaxPrice != nil {
+		query = query.Where("products.price <= ?", *p.MaxPrice)
+	}
+	query = withAttributes(query, p.Attributes, p.AttributeMin, p.AttributeMax)
+	if p.HasImages != nil {
+		exists := "EXISTS (SELECT 1 FROM product_images WHERE product_images.product_id = products.id)"
+		if *p.HasImages {
+			query = query.Where(exists)
+		} else {
+			query = query.Where("NOT " + exists)
+		}
+	}
+	return query
+}
+
+func (p *productListParams) applyPage(query *gorm.DB) *gorm.DB {
+	column := "products." + productSortColumns[p.Sort]
+	direction, comparator := "ASC", ">"
+	if p.Desc {
+		direction, comparator = "DESC", "<"
+	}
+
+	if p.Cursor != nil {
+		value, _ := p.cursorValue()
+		query = query.Where(fmt.Sprintf("(%s, products.id) %s (?, ?)", column, comparator), value, p.Cursor.ID)
+	}
+
+	return query.
+		Order(fmt.Sprintf("%s %s, products.id %s", column, direction, direction)).
+		Limit(p.Limit + 1)
+}
+
+func (p *productListParams) cursorValue() (any, error) {
+	switch p.Sort {
+	case "price":
+		return strconv.ParseFloat(p.Cursor.Value, 64)
+	case "created", "updated":
+		return time.Parse(time.RFC3339Nano, p.Cursor.Value)
+	default:
+		return p.Cursor.Value, nil
+	}
+}
+
+func (p *productListParams) cursorFor(product models.Product) string {
+	cursor := productCursor{Sort: p.Sort, ID: product.ID}
+	switch p.Sort {
+	case "price":
+		cursor.Value = strconv.FormatFloat(product.Price, 'f', -1, 64)
+	case "name":
+		cursor.Value = product.Name
+	case "created":
+		cursor.Value = product.CreatedAt.Format(time.RFC3339Nano)
+	case "updated":
+		cursor.Value = product.UpdatedAt.Format(time.RFC3339Nano)
+	}
+
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeProductCursor(raw string) (*productCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cursor productCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID == 0 {
+		return nil, errors.New("cursor without id")
+	}
+	return &cursor, nil
+}
+
+// listProducts runs a filtered, keyset-paginated query. base must already be
+// scoped to the products the caller is allowed to see; public listings only
+// show what shared catalogs may show of bundle components.
+func listProducts(base *gorm.DB, params *productListParams, public bool) (*productListResponse, error) {
+	filtered := params.applyFilters(base.Model(&models.Product{}))
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	details := withProductDetails
+	if public {
+		details = withPublicProductDetails
+	}
+	products := []models.Product{}
+	if err := details(params.applyPage(filtered.Session(&gorm.Session{}))).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	if public {
+		publicBundleComponents(products)
+	}
+
+	response := &productListResponse{Total: total}
+	if len(products) > params.Limit {
+		products = products[:params.Limit]
+		next := params.cursorFor(products[len(products)-1])
+		response.NextCursor = &next
+	}
+	response.Products = products
+
+	return response, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"gorm.io/gorm"
+)
+
+var localTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+// ownerLocation returns the owner's store timezone, falling back to the
+// default when the stored name cannot be loaded.
+func ownerLocation(db *gorm.DB, ownerID uint) (*time.Location, error) {
+	var timezone string
+	if err := db.Model(&models.User{}).Where("id = ?", ownerID).Pluck("timezone", &timezone).Error; err != nil {
+		return nil, err
+	}
+	if location, err := time.LoadLocation(timezone); err == nil && timezone != "" {
+		return location, nil
+	}
+	return time.LoadLocation(models.DefaultTimezone)
+}
+
+// parseStoreTime reads a timestamp sent by the owner. A bare date starts at
+// midnight, or, for the end of a window, lasts through that whole day.
+func parseStoreTime(field, raw string, location *time.Location, isEnd bool) (*time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &parsed, nil
+	}
+	for _, layout := range localTimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, raw, location); err == nil {
+			return &parsed, nil
+		}
+	}
+	parsed, err := time.ParseInLocation(time.DateOnly, raw, location)
+	if err != nil {
+		return nil, newValidationError("Invalid %s", field)
+	}
+	if isEnd {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return &parsed, nil
+}
+
+// validateProductPricing checks the promotional fields as they will be stored.
+func validateProductPricing(product *models.Product) error {
+	if product.CompareAtPrice != nil && *product.CompareAtPrice <= 0 {
+		return newValidationError("compare_at_price must be greater than zero")
+	}
+	if product.SalePrice != nil {
+		if *product.SalePrice < 0 {
+			return newValidationError("sale_price cannot be negative")
+		}
+		if *product.SalePrice >= product.Price {
+			return newValidationError("sale_price must be lower than price")
+		}
+	} else if product.SaleStartsAt != nil || product.SaleEndsAt != nil {
+		return newValidationError("sale_price is required to schedule a sale")
+	}
+	if product.SaleStartsAt != nil && product.SaleEndsAt != nil && !product.SaleEndsAt.After(*product.SaleStartsAt) {
+		return newValidationError("sale_ends_at must be after sale_starts_at")
+	}
+	return nil
+}
+
+// applyPricingInput copies the promotional fields of a create or update
+// request onto product. Null prices, a compare_at_price of 0 or less, a
+// negative sale_price and empty dates clear the field.
+func applyPricingInput(product *models.Product, location *time.Location, compareAt, salePrice models.NullablePrice, startsAt, endsAt *string) error {
+	if compareAt.Sent {
+		product.CompareAtPrice = nil
+		if compareAt.Value != nil && *compareAt.Value > 0 {
+			value := *compareAt.Value
+			product.CompareAtPrice = &value
+		}
+	}
+	if salePrice.Sent {
+		product.SalePrice = nil
+		if salePrice.Value != nil && *salePrice.Value >= 0 {
+			value := *salePrice.Value
+			product.SalePrice = &value
+		}
+	}
+	if startsAt != nil {
+		parsed, err := parseStoreTime("sale_starts_at", *startsAt, location, false)
+		if err != nil {
+			return err
+		}
+		product.SaleStartsAt = parsed
+	}
+	if endsAt != nil {
+		parsed, err := parseStoreTime("sale_ends_at", *endsAt, location, true)
+		if err != nil {
+			return err
+		}
+		product.SaleEndsAt = parsed
+	}
+	return validateProductPricing(product)
+}
+
+func pricingChanged(compareAt, salePrice models.NullablePrice, startsAt, endsAt *string) bool {
+	return compareAt.Sent || salePrice.Sent || startsAt != nil || endsAt != nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"gorm.io/gorm"
+)
+
+func normalizeProductStatus(status string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if status == "" {
+		return models.ProductStatusPublished, nil
+	}
+	if !slices.Contains(models.ProductStatuses, status) {
+		return "", newValidationError("Invalid status")
+	}
+	return status, nil
+}
+
+// publiclyVisible keeps products that are published and whose scheduled
+// publishing time, if any, has passed.
+func publiclyVisible(query *gorm.DB) *gorm.DB {
+	return query.Where(
+		"products.status = ? AND (products.publish_at IS NULL OR products.publish_at <= NOW())",
+		models.ProductStatusPublished,
+	)
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxProductOptions = 3
+
+// validationError carries a message that is safe to return to the client.
+type validationError struct {
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+func newValidationError(format string, args ...any) error {
+	return &validationError{message: fmt.Sprintf(format, args...)}
+}
+
+// bindJSONFormField decodes a JSON-encoded multipart field into target. JSON
+// requests are bound by ShouldBind instead, so a missing field is not an error.
+func bindJSONFormField(c *gin.Context, field string, target any) (bool, error) {
+	raw, ok := c.GetPostForm(field)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(raw), target); err != nil {
+		return false, newValidationError("Invalid %s", field)
+	}
+	return true, nil
+}
+
+func normalizeSKU(sku *string) *string {
+	if sku == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*sku)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+func buildProductOptions(inputs []models.ProductOptionInput) ([]models.ProductOption, error) {
+	if len(inputs) > maxProductOptions {
+		return nil, newValidationError("A product can have at most %d options", maxProductOptions)
+	}
+
+	options := make([]models.ProductOption, 0, len(inputs))
+	seenNames := map[string]bool{}
+	for i, input := range inputs {
+		name := strings.TrimSpace(input.Name)
+		if name == "" {
+			return nil, newValidationError("Option name is required")
+		}
+		if seenNames[strings.ToLower(name)] {
+			return nil, newValidationError("Duplicate option %q", name)
+		}
+		seenNames[strings.ToLower(name)] = true
+
+		values := make([]string, 0, len(input.Values))
+		seenValues := map[string]bool{}
+		for _, value := range input.Values {
+			value = strings.TrimSpace(value)
+			if value == "" || seenValues[strings.ToLower(value)] {
+				continue
+			}
+			seenValues[strings.ToLower(value)] = true
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return nil, newValidationError("Option %q needs at least one value", name)
+		}
+
+		options = append(options, models.ProductOption{Name: name, Values: values, Position: i})
+	}
+	return options, nil
+}
+
+// validateVariantOptions checks that every variant picks exactly one listed
+// value per option and that no two variants share a combination.
+func validateVariantOptions(options []models.ProductOption, variants []map[string]string) error {
+	if len(variants) > 0 && len(options) == 0 {
+		return newValidationError("Variants require at least one option")
+	}
+
+	seenCombinations := map[string]bool{}
+	for _, selected := range variants {
+		if len(selected) != len(options) {
+			return newValidationError("Each variant must pick one value for every option")
+		}
+
+		parts := make([]string, 0, len(options))
+		for _, option := range options {
+			value, ok := selected[option.Name]
+			if !ok {
+				return newValidationError("Variant is missing option %q", option.Name)
+			}
+			valid := false
+			for _, allowed := range option.Values {
+				if allowed == value {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return newValidationError("Invalid value %q for option %q", value, option.Name)
+			}
+			parts = append(parts, value)
+		}
+
+		key := strings.Join(parts, "\x00")
+		if seenCombinations[key] {
+			return newValidationError("Duplicate variant %s", strings.Join(parts, " / "))
+		}
+		seenCombinations[key] = true
+	}
+	return nil
+}
+
+// variantSKUIndex is the unique index behind ensureSKUsAvailable for
+// variants; writes that race past the check fail on it.
+const variantSKUIndex = "idx_product_variants_owner_sku_live"
+
+func isVariantSKUConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == variantSKUIndex
+}
+
+// ensureSKUsAvailable rejects SKUs used more than once in the request or
+// already taken by another product or variant of the same owner.
+func ensureSKUsAvailable(tx *gorm.DB, ownerID, productID uint, productSKU *string, variants []models.ProductVariantInput) error {
+	skus := []string{}
+	if productSKU != nil {
+		skus = append(skus, *productSKU)
+	}
+	for _, variant := range variants {
+		if sku := normalizeSKU(variant.SKU); sku != nil {
+			skus = append(skus, *sku)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, sku := range skus {
+		if seen[sku] {
+			return newValidationError("SKU %q is used more than once", sku)
+		}
+		seen[sku] = true
+	}
+	if len(skus) == 0 {
+		return nil
+	}
+
+	var taken []string
+	err := tx.Model(&models.Product{}).
+		Where("owner_id = ? AND id <> ? AND sku IN ?", ownerID, productID, skus).
+		Pluck("sku", &taken).Error
+	if err != nil {
+		return err
+	}
+	if len(taken) == 0 {
+		err = tx.Model(&models.ProductVariant{}).
+			Joins("JOIN products ON products.id = product_variants.product_id").
+			Where("products.owner_id = ? AND products.deleted_at IS NULL AND product_variants.product_id <> ? AND product_variants.sku IN ?", ownerID, productID, skus).
+			Pluck("product_variants.sku", &taken).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(taken) > 0 {
+		return newValidationError("SKU %q is already in use", taken[0])
+	}
+	return nil
+}
+
+func replaceProductOptions(tx *gorm.DB, productID uint, options []models.ProductOption) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductOption{}).Error; err != nil {
+		return err
+	}
+	for i := range options {
+		options[i].ProductID = productID
+		if err := tx.Create(&options[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceProductVariants makes the stored variants match inputs: entries with
+// an id update that variant, entries without one are created and anything not
+// listed is removed. uploadedImageIDs resolves image_index references to
+// images added in the same request. Stock level changes go through the ledger.
+func replaceProductVariants(tx *gorm.DB, product *models.Product, userID uint, inputs []models.ProductVariantInput, uploadedImageIDs []uint) error {
+	productID := product.ID
+
+	var existing []models.ProductVariant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+		return err
+	}
+	existingByID := make(map[uint]models.ProductVariant, len(existing))
+	for _, variant := range existing {
+		existingByID[variant.ID] = variant
+	}
+	// SKUs are set again below; clearing them first lets variants swap SKUs
+	// without tripping the unique index on the way.
+	if err := tx.Model(&models.ProductVariant{}).Where("product_id = ? AND sku IS NOT NULL", productID).Update("sku", nil).Error; err != nil {
+		return err
+	}
+
+	var productImageIDs []uint
+	if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).Pluck("id", &productImageIDs).Error; err != nil {
+		return err
+	}
+	isProductImage := make(map[uint]bool, len(productImageIDs))
+	for _, id := range productImageIDs {
+		isProductImage[id] = true
+	}
+
+	keep := map[uint]bool{}
+	for i, input := range inputs {
+		variant := models.ProductVariant{ProductID: productID, Available: true}
+		if input.ID != nil {
+			current, ok := existingByID[*input.ID]
+			if !ok {
+				return newValidationError("Variant %d not found", *input.ID)
+			}
+			variant = current
+			keep[current.ID] = true
+		}
+
+		if input.Price != nil && *input.Price < 0 {
+			return newValidationError("Variant price cannot be negative")
+		}
+		if input.StockQuantity != nil && *input.StockQuantity < 0 {
+			return newValidationError("Variant stock cannot be negative")
+		}
+
+		variant.SKU = normalizeSKU(input.SKU)
+		variant.Options = input.Options
+		variant.Price = input.Price
+		variant.Position = i
+		if input.Available != nil {
+			variant.Available = *input.Available
+		}
+
+		variant.ImageID = nil
+		switch {
+		case input.ImageIndex != nil:
+			if *input.ImageIndex < 0 || *input.ImageIndex >= len(uploadedImageIDs) {
+				return newValidationError("Invalid image_index for variant")
+			}
+			variant.ImageID = &uploadedImageIDs[*input.ImageIndex]
+		case input.ImageID != nil:
+			if !isProductImage[*input.ImageID] {
+				return newValidationError("Invalid image_id for variant")
+			}
+			variant.ImageID = input.ImageID
+		}
+
+		if err := tx.Save(&variant).Error; err != nil {
+			if isVariantSKUConflict(err) {
+				return newValidationError("SKU %q is already in use", *variant.SKU)
+			}
+			return err
+		}
+
+		if input.StockQuantity != nil {
+			reason := models.StockReasonAdjustment
+			if input.ID == nil {
+				reason = models.StockReasonInitial
+			}
+			err := applyStockChange(tx, stockChange{
+				Product: product,
+				Variant: &variant,
+				UserID:  userID,
+				Before:  variant.StockQuantity,
+				After:   *input.StockQuantity,
+				Reason:  reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var removed []uint
+	for _, variant := range existing {
+		if !keep[variant.ID] {
+			removed = append(removed, variant.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := tx.Delete(&models.ProductVariant{}, removed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func variantSelections(inputs []models.ProductVariantInput) []map[string]string {
+	selections := make([]map[string]string, len(inputs))
+	for i, input := range inputs {
+		selections[i] = input.Options
+	}
+	return selections
+}
+
+func storedVariantSelections(variants []models.ProductVariant) []map[string]string {
+	selections := make([]map[string]string, len(variants))
+	for i, variant := range variants {
+		selections[i] = variant.Options
+	}
+	return selections
+}
+
+func respondValidationError(c *gin.Context, err error, fallback string) {
+	var validation *validationError
+	if errors.As(err, &validation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
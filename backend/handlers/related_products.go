@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxRelatedProducts    = 20
+	defaultSuggestions    = 4
+	maxSuggestions        = 20
+	maxAffinityCartLength = 20
+	maxCartIDLength       = 64
+	// maxQuotedCartsPerHour is how many carts one client can add to the
+	// counts of a catalog each hour.
+	maxQuotedCartsPerHour = 10
+	quotedCartRetention   = 30 * 24 * time.Hour
+)
+
+const (
+	suggestionRelated        = "related"
+	suggestionQuotedTogether = "quoted_together"
+	suggestionSharedTag      = "shared_tag"
+	suggestionSameCollection = "same_collection"
+)
+
+type catalogSuggestion struct {
+	Reason  string         `json:"reason"`
+	Product models.Product `json:"product"`
+}
+
+func GetRelatedProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
+
+	related, err := relatedProducts(database.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve related products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, related)
+}
+
+// UpdateRelatedProducts replaces the products the owner suggests alongside a
+// product, in the given order.
+func UpdateRelatedProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.UpdateRelatedProductsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if len(input.ProductIDs) > maxRelatedProducts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A product can have at most %d related products", maxRelatedProducts)})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&product).Error; err != nil {
+			return err
+		}
+
+		for i, relatedID := range input.ProductIDs {
+			if relatedID == product.ID {
+				return newValidationError("A product cannot be related to itself")
+			}
+			if slices.Contains(input.ProductIDs[:i], relatedID) {
+				return newValidationError("Product %d is listed more than once", relatedID)
+			}
+		}
+		if len(input.ProductIDs) > 0 {
+			var count int64
+			if err := tx.Model(&models.Product{}).Where("id IN ? AND owner_id = ?", input.ProductIDs, ownerID).Count(&count).Error; err != nil {
+				return err
+			}
+			if int(count) != len(input.ProductIDs) {
+				return newValidationError("Related products not found")
+			}
+		}
+
+		if err := tx.Where("product_id = ?", product.ID).Delete(&models.RelatedProduct{}).Error; err != nil {
+			return err
+		}
+		links := make([]models.RelatedProduct, len(input.ProductIDs))
+		for i, relatedID := range input.ProductIDs {
+			links[i] = models.RelatedProduct{ProductID: product.ID, RelatedID: relatedID, Position: i}
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.Create(&links).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		respondValidationError(c, err, "Could not update related products")
+		return
+	}
+
+	related, err := relatedProducts(database.DB, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve related products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, related)
+}
+
+func relatedProducts(db *gorm.DB, productID uint) ([]models.Product, error) {
+	products := []models.Product{}
+	err := withProductDetails(db).
+		Joins("JOIN related_products ON related_products.related_id = products.id").
+		Where("related_products.product_id = ?", productID).
+		Order("related_products.position asc").
+		Find(&products).Error
+	return products, err
+}
+
+// recordAffinities counts the products of a cart as quoted together. Large
+// carts are skipped; they say little about any single pair.
+func recordAffinities(tx *gorm.DB, productIDs []uint) error {
+	ids := slices.Clone(productIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) < 2 || len(ids) > maxAffinityCartLength {
+		return nil
+	}
+
+	pairs := make([]models.ProductAffinity, 0, len(ids)*(len(ids)-1))
+	for _, productID := range ids {
+		for _, relatedID := range ids {
+			if productID != relatedID {
+				pairs = append(pairs, models.ProductAffinity{ProductID: productID, RelatedID: relatedID, Count: 1})
+			}
+		}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "related_id"}},
+		DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr("product_affinities.count + 1")}),
+	}).Create(&pairs).Error
+}
+
+// GetCatalogSuggestions suggests other products of a shared catalog to show
+// next to one of them: the owner's picks first, then products sharing its
+// tags, then products often quoted with it, then the rest of the catalog in
+// its usual order.
+func GetCatalogSuggestions(c *gin.Context) {
+	collection, ok := findSharedCollection(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	limit := defaultSuggestions
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(limit, maxSuggestions)
+	}
+
+	var product models.Product
+	if err := catalogProducts(collection).Where("products.id = ?", uint(id)).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve suggestions"})
+		return
+	}
+
+	sources := []struct {
+		reason string
+		query  func() *gorm.DB
+	}{
+		{suggestionRelated, func() *gorm.DB {
+			return catalogProducts(collection).
+				Joins("JOIN related_products ON related_products.related_id = products.id AND related_products.product_id = ?", product.ID).
+				Order("related_products.position asc")
+		}},
+		{suggestionSharedTag, func() *gorm.DB {
+			shared := "(SELECT COUNT(*) FROM product_tags own JOIN product_tags other ON other.tag_id = own.tag_id WHERE own.product_id = ? AND other.product_id = products.id)"
+			return catalogProducts(collection).
+				Where(shared+" > 0", product.ID).
+				Order(clause.OrderBy{Expression: clause.Expr{SQL: shared + " DESC, products.id ASC", Vars: []any{product.ID}, WithoutParentheses: true}})
+		}},
+		{suggestionQuotedTogether, func() *gorm.DB {
+			return catalogProducts(collection).
+				Joins("JOIN product_affinities ON product_affinities.related_id = products.id AND product_affinities.product_id = ?", product.ID).
+				Order("product_affinities.count desc, products.id asc")
+		}},
+		{suggestionSameCollection, func() *gorm.DB {
+			return orderedInCollection(catalogProducts(collection), collection.ID)
+		}},
+	}
+
+	chosen := []uint{product.ID}
+	reasons := map[uint]string{}
+	for _, source := range sources {
+		if len(chosen)-1 >= limit {
+			break
+		}
+		var ids []uint
+		if err := source.query().Model(&models.Product{}).
+			Where("products.id NOT IN ?", chosen).
+			Limit(limit-len(chosen)+1).
+			Pluck("products.id", &ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve suggestions"})
+			return
+		}
+		for _, suggestedID := range ids {
+			reasons[suggestedID] = source.reason
+		}
+		chosen = append(chosen, ids...)
+	}
+	chosen = chosen[1:]
+
+	var products []models.Product
+	if err := withPublicProductDetails(database.DB).Where("id IN ?", chosen).Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve suggestions"})
+		return
+	}
+	publicBundleComponents(products)
+
+	suggestions := make([]catalogSuggestion, 0, len(products))
+	for _, suggestedID := range chosen {
+		if index := slices.IndexFunc(products, func(p models.Product) bool { return p.ID == suggestedID }); index >= 0 {
+			suggestions = append(suggestions, catalogSuggestion{Reason: reasons[suggestedID], Product: products[index]})
+		}
+	}
+
+	c.JSON(http.StatusOK, suggestions)
+}
+
+// recordQuoteAffinities counts a quoted cart the first time its id is seen,
+// up to maxQuotedCartsPerHour carts per client and catalog. It keeps quoting
+// working when the counts cannot be saved.
+func recordQuoteAffinities(c *gin.Context, collection *models.Collection, input *models.QuoteInput) {
+	if input.CartID == "" || len(input.CartID) > maxCartIDLength {
+		return
+	}
+	productIDs := make([]uint, len(input.Items))
+	for i, item := range input.Items {
+		productIDs[i] = item.ProductID
+	}
+	client := sha256.Sum256([]byte(c.ClientIP()))
+	clientHash := hex.EncodeToString(client[:])
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var recent int64
+		if err := tx.Model(&models.QuotedCart{}).
+			Where("collection_id = ? AND client_hash = ? AND created_at > ?", collection.ID, clientHash, time.Now().Add(-time.Hour)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent >= maxQuotedCartsPerHour {
+			return nil
+		}
+
+		cart := models.QuotedCart{CollectionID: collection.ID, CartID: input.CartID, ClientHash: clientHash}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&cart)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return recordAffinities(tx, productIDs)
+	})
+	if err != nil {
+		log.Printf("could not record product affinities: %v", err)
+	}
+}
+
+// purgeQuotedCarts forgets carts past quotedCartRetention; quoting one of
+// them again counts it again.
+func purgeQuotedCarts() {
+	if err := database.DB.Where("created_at < ?", time.Now().Add(-quotedCartRetention)).Delete(&models.QuotedCart{}).Error; err != nil {
+		log.Printf("quoted cart purge: %v", err)
+	}
+}
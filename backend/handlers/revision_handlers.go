@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxRevisionsListed = 100
+
+func productSnapshot(tx *gorm.DB, productID uint) (models.ProductSnapshot, error) {
+	var product models.Product
+	err := tx.Preload("CollectionLinks", liveCollectionLinks).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("tags.name asc") }).
+		First(&product, productID).Error
+	if err != nil {
+		return models.ProductSnapshot{}, err
+	}
+
+	collectionIDs := slices.Clone(product.CollectionIDs)
+	slices.Sort(collectionIDs)
+	tags := make([]string, len(product.Tags))
+	for i, tag := range product.Tags {
+		tags[i] = tag.Name
+	}
+
+	return models.ProductSnapshot{
+		Name:              product.Name,
+		Description:       product.Description,
+		Price:             product.Price,
+		SKU:               product.SKU,
+		Status:            product.Status,
+		PublishAt:         product.PublishAt,
+		CompareAtPrice:    product.CompareAtPrice,
+		SalePrice:         product.SalePrice,
+		SaleStartsAt:      product.SaleStartsAt,
+		SaleEndsAt:        product.SaleEndsAt,
+		TrackStock:        product.TrackStock,
+		AllowBackorder:    product.AllowBackorder,
+		LowStockThreshold: product.LowStockThreshold,
+		SaleUnit:          product.SaleUnit,
+		MinOrderQuantity:  product.MinOrderQuantity,
+		CollectionIDs:     collectionIDs,
+		Tags:              tags,
+	}, nil
+}
+
+func collectionSnapshot(collection *models.Collection) models.CollectionSnapshot {
+	return models.CollectionSnapshot{Name: collection.Name, Description: collection.Description}
+}
+
+// snapshotFields turns a snapshot into its JSON form, which is what revisions
+// store and compare.
+func snapshotFields(snapshot any) (map[string]any, error) {
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// recordRevision stores a revision when the snapshots differ. Changes are
+// listed in field name order.
+func recordRevision(tx *gorm.DB, revision models.Revision, before, after any) error {
+	beforeFields, err := snapshotFields(before)
+	if err != nil {
+		return err
+	}
+	afterFields, err := snapshotFields(after)
+	if err != nil {
+		return err
+	}
+
+	fields := make([]string, 0, len(afterFields))
+	for field := range afterFields {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	revision.Changes = []models.FieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			revision.Changes = append(revision.Changes, models.FieldChange{Field: field, Before: beforeFields[field], After: afterFields[field]})
+		}
+	}
+	if len(revision.Changes) == 0 {
+		return nil
+	}
+
+	revision.Snapshot = afterFields
+	return tx.Create(&revision).Error
+}
+
+func GetProductRevisions(c *gin.Context) {
+	getRevisions(c, models.RevisionEntityProduct)
+}
+
+func GetCollectionRevisions(c *gin.Context) {
+	getRevisions(c, models.RevisionEntityCollection)
+}
+
+func getRevisions(c *gin.Context, entityType string) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var revisions []models.Revision
+	if err := database.DB.Where("owner_id = ? AND entity_type = ? AND entity_id = ?", ownerID, entityType, uint(id)).
+		Order("created_at desc, id desc").
+		Limit(maxRevisionsListed).
+		Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// revisionTarget is the state a restore puts a product back to: the
+// revision's snapshot, or with ?to=before the state just before it, which is
+// the snapshot with every changed field set back to its previous value.
+func revisionTarget(revision *models.Revision, to string) (models.ProductSnapshot, error) {
+	fields := maps.Clone(revision.Snapshot)
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	if to == "before" {
+		for _, change := range revision.Changes {
+			fields[change.Field] = change.Before
+		}
+	}
+
+	var target models.ProductSnapshot
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return target, err
+	}
+	err = json.Unmarshal(encoded, &target)
+	return target, err
+}
+
+// RestoreProductRevision puts the tracked fields of a product back to how
+// they were after the given revision, or before it with ?to=before. The
+// rollback is itself recorded as a new revision. Collections deleted since
+// then are left out.
+func RestoreProductRevision(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	revisionID, err := strconv.ParseUint(c.Param("revision_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision_id"})
+		return
+	}
+	to := c.DefaultQuery("to", "after")
+	if to != "after" && to != "before" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after or before"})
+		return
+	}
+
+	var plan *models.Plan
+	var currentCount int
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND owner_id = ?", uint(id), ownerID).
+			First(&product).Error; err != nil {
+			return err
+		}
+
+		var revision models.Revision
+		if err := tx.Where("id = ? AND owner_id = ? AND entity_type = ? AND entity_id = ?", uint(revisionID), ownerID, models.RevisionEntityProduct, product.ID).
+			First(&revision).Error; err != nil {
+			return err
+		}
+		target, err := revisionTarget(&revision, to)
+		if err != nil {
+			return err
+		}
+
+		before, err := productSnapshot(tx, product.ID)
+		if err != nil {
+			return err
+		}
+
+		if product.Status == models.ProductStatusArchived && target.Status != models.ProductStatusArchived {
+			allowed, lockedPlan, count, err := CheckProductLimit(tx, ownerID)
+			if err != nil {
+				return err
+			}
+			plan, currentCount = lockedPlan, count
+			if !allowed {
+				return errPlanLimitReached
+			}
+		}
+		if err := ensureSKUsAvailable(tx, ownerID, product.ID, target.SKU, nil); err != nil {
+			return err
+		}
+		priced := product
+		priced.Price = target.Price
+		priced.CompareAtPrice = target.CompareAtPrice
+		priced.SalePrice = target.SalePrice
+		priced.SaleStartsAt = target.SaleStartsAt
+		priced.SaleEndsAt = target.SaleEndsAt
+		if err := validateProductPricing(&priced); err != nil {
+			return err
+		}
+
+		updates := map[string]any{
+			"name":                target.Name,
+			"description":         target.Description,
+			"price":               target.Price,
+			"sku":                 target.SKU,
+			"status":              target.Status,
+			"publish_at":          target.PublishAt,
+			"compare_at_price":    target.CompareAtPrice,
+			"sale_price":          target.SalePrice,
+			"sale_starts_at":      target.SaleStartsAt,
+			"sale_ends_at":        target.SaleEndsAt,
+			"track_stock":         target.TrackStock,
+			"allow_backorder":     target.AllowBackorder,
+			"low_stock_threshold": target.LowStockThreshold,
+		}
+		// Revisions from before sale units existed leave these as they are.
+		if target.SaleUnit != "" && target.SaleUnit != product.SaleUnit {
+			if err := ensureTiersFitSaleUnit(tx, product.ID, target.SaleUnit); err != nil {
+				return err
+			}
+		}
+		if target.SaleUnit != "" {
+			updates["sale_unit"] = target.SaleUnit
+			updates["min_order_quantity"] = target.MinOrderQuantity
+		}
+		if err := tx.Model(&product).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		var collectionIDs []uint
+		if len(target.CollectionIDs) > 0 {
+			if err := tx.Model(&models.Collection{}).
+				Where("id IN ? AND owner_id = ?", target.CollectionIDs, ownerID).
+				Pluck("id", &collectionIDs).Error; err != nil {
+				return err
+			}
+		}
+		if err := replaceProductCollections(tx, product.ID, collectionIDs); err != nil {
+			return err
+		}
+		if err := updateProductAttributes(tx, product.ID, nil, false); err != nil {
+			return err
+		}
+		if err := replaceProductTags(tx, &product, target.Tags); err != nil {
+			return err
+		}
+
+		after, err := productSnapshot(tx, product.ID)
+		if err != nil {
+			return err
+		}
+		return recordRevision(tx, models.Revision{
+			OwnerID:        ownerID,
+			UserID:         ownerID,
+			EntityType:     models.RevisionEntityProduct,
+			EntityID:       product.ID,
+			RestoredFromID: &revision.ID,
+		}, before, after)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errPlanLimitReached):
+			respondPlanLimit(c, "Product limit reached", plan.MaxProducts, plan, currentCount)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		default:
+			respondValidationError(c, err, "Could not restore revision")
+		}
+		return
+	}
+
+	var restored models.Product
+	if err := withProductDetails(database.DB).First(&restored, uint(id)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve restored product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchTermRunes = 200
+
+	// Control characters never typed by owners, swapped for <mark> tags only
+	// after the surrounding text has been HTML-escaped.
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+type productSearchResult struct {
+	Product            models.Product `json:"product"`
+	Rank               float64        `json:"rank"`
+	NameHighlight      string         `json:"name_highlight"`
+	DescriptionSnippet string         `json:"description_snippet"`
+}
+
+type productSearchResponse struct {
+	Results []productSearchResult `json:"results"`
+	Total   int64                 `json:"total"`
+}
+
+type productSearchRow struct {
+	ID                 uint
+	Rank               float64
+	NameHighlight      string
+	DescriptionSnippet string
+}
+
+func SearchMyProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	respondProductSearch(c, database.DB.Where("products.owner_id = ?", ownerID), false)
+}
+
+func SearchPublicCatalog(c *gin.Context) {
+	collection, ok := findSharedCollection(c)
+	if !ok {
+		return
+	}
+
+	respondProductSearch(c, catalogProducts(collection), true)
+}
+
+func respondProductSearch(c *gin.Context, scope *gorm.DB, public bool) {
+	term := strings.TrimSpace(c.Query("q"))
+	if term == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	if utf8.RuneCountInString(term) > maxSearchTermRunes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search term too long"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		offset = parsed
+	}
+
+	response, err := searchProducts(scope, term, limit, offset, public)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not search products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func searchProducts(scope *gorm.DB, term string, limit, offset int, public bool) (*productSearchResponse, error) {
+	matching := scope.Model(&models.Product{}).
+		Joins("CROSS JOIN websearch_to_tsquery('portuguese_unaccent', ?) AS search(query)", term).
+		Where("products.search_vector @@ search.query")
+
+	var total int64
+	if err := matching.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	headlineOptions := "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+	var rows []productSearchRow
+	err := matching.Session(&gorm.Session{}).
+		Select(
+			"products.id, "+
+				"ts_rank_cd(products.search_vector, search.query) AS rank, "+
+				"ts_headline('portuguese_unaccent', products.name, search.query, ?) AS name_highlight, "+
+				"ts_headline('portuguese_unaccent', products.description, search.query, ?) AS description_snippet",
+			headlineOptions+", HighlightAll=true",
+			headlineOptions+", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \"",
+		).
+		Order("rank DESC, products.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	response := &productSearchResponse{Results: []productSearchResult{}, Total: total}
+	if len(rows) == 0 {
+		return response, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+
+	details := withProductDetails
+	if public {
+		details = withPublicProductDetails
+	}
+	var products []models.Product
+	if err := details(database.DB).Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	if public {
+		publicBundleComponents(products)
+	}
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	for _, row := range rows {
+		product, ok := byID[row.ID]
+		if !ok {
+			continue
+		}
+		response.Results = append(response.Results, productSearchResult{
+			Product:            product,
+			Rank:               row.Rank,
+			NameHighlight:      renderHighlight(row.NameHighlight),
+			DescriptionSnippet: renderHighlight(row.DescriptionSnippet),
+		})
+	}
+
+	return response, nil
+}
+
+func renderHighlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
@@ -19,6 +19,7 @@ type shareCollectionResponse struct {
 type publicCatalogResponse struct {
 	Collection models.Collection `json:"collection"`
 	Products   []models.Product  `json:"products"`
+	Tags       []string          `json:"tags"`
 	OwnerPhone string            `json:"owner_phone"`
 	StoreName  string            `json:"store_name"`
 }
@@ -64,20 +65,36 @@ func ShareCollection(c *gin.Context) {
 	c.JSON(http.StatusOK, shareCollectionResponse{ShareToken: *collection.ShareToken})
 }
 
-func GetPublicCatalogByToken(c *gin.Context) {
+// findSharedCollection resolves a share token, writing the error response
+// itself when the catalog cannot be served.
+func findSharedCollection(c *gin.Context) (*models.Collection, bool) {
 	token := c.Param("token")
 	if token == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
-		return
+		return nil, false
 	}
 
 	var collection models.Collection
 	if err := database.DB.Where("share_token = ?", token).First(&collection).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Catalog not found"})
-			return
+			return nil, false
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve catalog"})
+		return nil, false
+	}
+
+	return &collection, true
+}
+
+// catalogProducts scopes a query to the products shown in a shared catalog.
+func catalogProducts(collection *models.Collection) *gorm.DB {
+	return publiclyVisible(inCollection(database.DB.Where("products.owner_id = ?", collection.OwnerID), collection.ID))
+}
+
+func GetPublicCatalogByToken(c *gin.Context) {
+	collection, ok := findSharedCollection(c)
+	if !ok {
 		return
 	}
 
@@ -90,10 +107,22 @@ func GetPublicCatalogByToken(c *gin.Context) {
 	}
 
 	var products []models.Product
-	if err := database.DB.Preload("Images").Where("owner_id = ? AND collection_id = ?", collection.OwnerID, collection.ID).Order("created_at desc").Find(&products).Error; err != nil {
+	if err := withPublicProductDetails(orderedInCollection(withTags(catalogProducts(collection), c.QueryArray("tag")), collection.ID)).Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
 		return
 	}
+	publicBundleComponents(products)
+
+	tags := []string{}
+	if err := database.DB.Model(&models.Tag{}).
+		Distinct("tags.name").
+		Joins("JOIN product_tags ON product_tags.tag_id = tags.id").
+		Where("product_tags.product_id IN (?)", catalogProducts(collection).Model(&models.Product{}).Select("products.id")).
+		Order("tags.name").
+		Pluck("tags.name", &tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tags"})
+		return
+	}
 
-	c.JSON(http.StatusOK, publicCatalogResponse{Collection: collection, Products: products, OwnerPhone: ownerPhone, StoreName: storeName})
+	c.JSON(http.StatusOK, publicCatalogResponse{Collection: *collection, Products: products, Tags: tags, OwnerPhone: ownerPhone, StoreName: storeName})
 }
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	trashRetention     = 30 * 24 * time.Hour
+	trashPurgeInterval = time.Hour
+	// trashPurgeLock is the advisory lock key held during a purge run.
+	trashPurgeLock = 470038
+)
+
+type trashedProduct struct {
+	models.Product
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type trashedCollection struct {
+	models.Collection
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type trashResponse struct {
+	Products    []trashedProduct    `json:"products"`
+	Collections []trashedCollection `json:"collections"`
+}
+
+func GetTrash(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var products []models.Product
+	if err := database.DB.Unscoped().
+		Preload("Images", orderByPosition).
+		Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).
+		Order("deleted_at desc").
+		Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve trash"})
+		return
+	}
+
+	var collections []models.Collection
+	if err := database.DB.Unscoped().
+		Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).
+		Order("deleted_at desc").
+		Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve trash"})
+		return
+	}
+
+	response := trashResponse{
+		Products:    make([]trashedProduct, len(products)),
+		Collections: make([]trashedCollection, len(collections)),
+	}
+	for i, product := range products {
+		response.Products[i] = trashedProduct{Product: product, PurgeAt: product.DeletedAt.Time.Add(trashRetention)}
+	}
+	for i, collection := range collections {
+		response.Collections[i] = trashedCollection{Collection: collection, PurgeAt: collection.DeletedAt.Time.Add(trashRetention)}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func trashItemID(c *gin.Context) (uint, uint, bool) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return 0, 0, false
+	}
+	return ownerID, uint(id), true
+}
+
+func findTrashedProduct(tx *gorm.DB, ownerID, id uint) (*models.Product, error) {
+	var product models.Product
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", id, ownerID).
+		First(&product).Error
+	return &product, err
+}
+
+func findTrashedCollection(tx *gorm.DB, ownerID, id uint) (*models.Collection, error) {
+	var collection models.Collection
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", id, ownerID).
+		First(&collection).Error
+	return &collection, err
+}
+
+// productsTrashedWith returns the products that went to the trash together
+// with the collection.
+func productsTrashedWith(tx *gorm.DB, collection *models.Collection) ([]models.Product, error) {
+	var products []models.Product
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "products"}}).
+		Where("products.owner_id = ? AND products.deleted_at = ?", collection.OwnerID, collection.DeletedAt.Time).
+		Where("EXISTS (SELECT 1 FROM product_collections WHERE product_collections.product_id = products.id AND product_collections.collection_id = ?)", collection.ID).
+		Find(&products).Error
+	return products, err
+}
+
+// ensureRestorableSKUs fails when a SKU of a trashed product has since been
+// given to another product or variant.
+func ensureRestorableSKUs(tx *gorm.DB, product *models.Product) error {
+	var variantSKUs []*string
+	if err := tx.Model(&models.ProductVariant{}).Where("product_id = ? AND sku IS NOT NULL", product.ID).Pluck("sku", &variantSKUs).Error; err != nil {
+		return err
+	}
+	variants := make([]models.ProductVariantInput, len(variantSKUs))
+	for i, sku := range variantSKUs {
+		variants[i].SKU = sku
+	}
+
+	if err := ensureSKUsAvailable(tx, product.OwnerID, product.ID, product.SKU, variants); err != nil {
+		var validation *validationError
+		if errors.As(err, &validation) {
+			return newValidationError("Cannot restore %q: %s", product.Name, validation.message)
+		}
+		return err
+	}
+	return nil
+}
+
+func countedProducts(products []models.Product) int {
+	count := 0
+	for _, product := range products {
+		if product.Status != models.ProductStatusArchived {
+			count++
+		}
+	}
+	return count
+}
+
+func RestoreProduct(c *gin.Context) {
+	ownerID, id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+
+	var plan *models.Plan
+	var currentCount int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		product, err := findTrashedProduct(tx, ownerID, id)
+		if err != nil {
+			return err
+		}
+
+		allowed, lockedPlan, count, err := CheckProductCapacity(tx, ownerID, countedProducts([]models.Product{*product}))
+		if err != nil {
+			return err
+		}
+		plan, currentCount = lockedPlan, count
+		if !allowed {
+			return errPlanLimitReached
+		}
+
+		if err := ensureRestorableSKUs(tx, product); err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(product).Update("deleted_at", nil).Error
+		if isVariantSKUConflict(err) {
+			return newValidationError("Cannot restore %q: a SKU of its variants is already in use", product.Name)
+		}
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errPlanLimitReached):
+			respondPlanLimit(c, "Product limit reached", plan.MaxProducts, plan, currentCount)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found in trash"})
+		default:
+			respondValidationError(c, err, "Could not restore product")
+		}
+		return
+	}
+
+	var restored models.Product
+	if err := withProductDetails(database.DB).First(&restored, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve restored product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
+
+// RestoreCollection brings back a collection together with the products that
+// were trashed along with it.
+func RestoreCollection(c *gin.Context) {
+	ownerID, id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+
+	var plan *models.Plan
+	var limit, currentCount int
+	var limitMessage string
+	var collection *models.Collection
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		collection, err = findTrashedCollection(tx, ownerID, id)
+		if err != nil {
+			return err
+		}
+
+		allowed, lockedPlan, count, err := CheckCollectionLimit(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			plan, limit, currentCount = lockedPlan, lockedPlan.MaxCollections, count
+			limitMessage = "Collection limit reached"
+			return errPlanLimitReached
+		}
+
+		products, err := productsTrashedWith(tx, collection)
+		if err != nil {
+			return err
+		}
+		allowed, lockedPlan, count, err = CheckProductCapacity(tx, ownerID, countedProducts(products))
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			plan, limit, currentCount = lockedPlan, lockedPlan.MaxProducts, count
+			limitMessage = "Product limit reached"
+			return errPlanLimitReached
+		}
+
+		productIDs := make([]uint, len(products))
+		for i := range products {
+			if err := ensureRestorableSKUs(tx, &products[i]); err != nil {
+				return err
+			}
+			productIDs[i] = products[i].ID
+		}
+		if len(productIDs) > 0 {
+			if err := tx.Unscoped().Model(&models.Product{}).Where("id IN ?", productIDs).Update("deleted_at", nil).Error; err != nil {
+				if isVariantSKUConflict(err) {
+					return newValidationError("Cannot restore the collection: a SKU of its variants is already in use")
+				}
+				return err
+			}
+		}
+		if err := tx.Unscoped().Model(collection).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		collection.DeletedAt = gorm.DeletedAt{}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errPlanLimitReached):
+			respondPlanLimit(c, limitMessage, limit, plan, currentCount)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found in trash"})
+		default:
+			respondValidationError(c, err, "Could not restore collection")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+func PurgeProduct(c *gin.Context) {
+	ownerID, id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+
+	var files []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		product, err := findTrashedProduct(tx, ownerID, id)
+		if err != nil {
+			return err
+		}
+		bundled, err := bundledProductIDs(tx, []uint{product.ID})
+		if err != nil {
+			return err
+		}
+		if len(bundled) > 0 {
+			return errProductInBundles
+		}
+		files, err = purgeProducts(tx, []uint{product.ID})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found in trash"})
+			return
+		}
+		if errors.Is(err, errProductInBundles) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product is part of bundles"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete product"})
+		return
+	}
+	removeUploadedFiles(files)
+
+	c.Status(http.StatusNoContent)
+}
+
+func PurgeCollection(c *gin.Context) {
+	ownerID, id, ok := trashItemID(c)
+	if !ok {
+		return
+	}
+
+	var files []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		collection, err := findTrashedCollection(tx, ownerID, id)
+		if err != nil {
+			return err
+		}
+		files, err = purgeCollection(tx, collection)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete collection"})
+		return
+	}
+	removeUploadedFiles(files)
+
+	c.Status(http.StatusNoContent)
+}
+
+// purgeProducts deletes products for good and returns the image files to
+// remove once the transaction has committed. Options, variants and
+// collection and tag links go with them through their foreign keys; their
+// revisions are deleted here.
+func purgeProducts(tx *gorm.DB, ids []uint) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var files []string
+	if err := tx.Model(&models.ProductImage{}).Where("product_id IN ?", ids).Pluck("image_url", &files).Error; err != nil {
+		return nil, err
+	}
+	var mainImages []string
+	if err := tx.Unscoped().Model(&models.Product{}).Where("id IN ? AND image_url IS NOT NULL", ids).Pluck("image_url", &mainImages).Error; err != nil {
+		return nil, err
+	}
+	for _, url := range mainImages {
+		if !slices.Contains(files, url) {
+			files = append(files, url)
+		}
+	}
+
+	if err := tx.Where("product_id IN ?", ids).Delete(&models.ProductImage{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("entity_type = ? AND entity_id IN ?", models.RevisionEntityProduct, ids).Delete(&models.Revision{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("bundle_id IN ?", ids).Delete(&models.BundleItem{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Product{}).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// purgeCollection deletes a trashed collection and the products trashed with it.
+func purgeCollection(tx *gorm.DB, collection *models.Collection) ([]string, error) {
+	products, err := productsTrashedWith(tx, collection)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	// Products that bundles still contain stay in the trash.
+	bundled, err := bundledProductIDs(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	ids = slices.DeleteFunc(ids, func(id uint) bool { return slices.Contains(bundled, id) })
+
+	files, err := purgeProducts(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.ProductCollection{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("entity_type = ? AND entity_id = ?", models.RevisionEntityCollection, collection.ID).Delete(&models.Revision{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.AttributeDefinition{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Delete(collection).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// StartTrashPurger permanently deletes trash older than the retention period,
+// once at startup and then every hour. A Postgres advisory lock keeps replicas
+// from purging, and deleting the same files, at the same time; a replica that
+// finds the lock taken skips that run.
+func StartTrashPurger() {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			runTrashPurge()
+			<-ticker.C
+		}
+	}()
+}
+
+func runTrashPurge() {
+	err := database.DB.Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", trashPurgeLock).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", trashPurgeLock)
+		purgeExpiredTrash()
+		purgeQuotedCarts()
+		return nil
+	})
+	if err != nil {
+		log.Printf("trash purge: %v", err)
+	}
+}
+
+func purgeExpiredTrash() {
+	cutoff := time.Now().Add(-trashRetention)
+
+	var collections []models.Collection
+	if err := database.DB.Unscoped().Where("deleted_at < ?", cutoff).Find(&collections).Error; err != nil {
+		log.Printf("trash purge: %v", err)
+		return
+	}
+	for i := range collections {
+		var files []string
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			files, err = purgeCollection(tx, &collections[i])
+			return err
+		})
+		if err != nil {
+			log.Printf("trash purge: collection %d: %v", collections[i].ID, err)
+			continue
+		}
+		removeUploadedFiles(files)
+	}
+
+	for {
+		var ids []uint
+		if err := database.DB.Unscoped().Model(&models.Product{}).
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM bundle_items WHERE bundle_items.component_id = products.id)").
+			Limit(100).Pluck("id", &ids).Error; err != nil {
+			log.Printf("trash purge: %v", err)
+			return
+		}
+		if len(ids) == 0 {
+			return
+		}
+
+		var files []string
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			files, err = purgeProducts(tx, ids)
+			return err
+		})
+		if err != nil {
+			log.Printf("trash purge: products %v: %v", ids, err)
+			return
+		}
+		removeUploadedFiles(files)
+	}
+}
@@ -0,0 +1,84 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	AttributeTypeText    = "text"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeList    = "list"
+)
+
+var AttributeTypes = []string{AttributeTypeText, AttributeTypeNumber, AttributeTypeBoolean, AttributeTypeList}
+
+// ProductAttribute is one line of a product's specification table, such as
+// "Voltagem: 220V" or "Largura: 120 cm". Only the column matching Type is
+// set; Value exposes it to clients.
+type ProductAttribute struct {
+	ID          uint     `gorm:"primaryKey" json:"id"`
+	ProductID   uint     `gorm:"not null;index" json:"product_id"`
+	Key         string   `gorm:"not null" json:"key"`
+	Type        string   `gorm:"type:varchar(20);not null" json:"type"`
+	TextValue   *string  `json:"-"`
+	NumberValue *float64 `json:"-"`
+	BoolValue   *bool    `json:"-"`
+	ListValue   []string `gorm:"serializer:json;type:text" json:"-"`
+	Unit        string   `gorm:"not null;default:''" json:"unit"`
+	Position    int      `gorm:"not null;default:0" json:"position"`
+	Value       any      `gorm:"-" json:"value"`
+}
+
+func (a *ProductAttribute) AfterFind(tx *gorm.DB) error {
+	a.RefreshValue()
+	return nil
+}
+
+// RefreshValue copies the typed column into Value.
+func (a *ProductAttribute) RefreshValue() {
+	switch a.Type {
+	case AttributeTypeNumber:
+		a.Value = a.NumberValue
+	case AttributeTypeBoolean:
+		a.Value = a.BoolValue
+	case AttributeTypeList:
+		a.Value = a.ListValue
+	default:
+		a.Value = a.TextValue
+	}
+}
+
+// AttributeDefinition is one entry of a collection's attribute schema.
+// Products in the collection must use the defined type and unit for the key,
+// pick from Options when there are any, and carry the attribute when it is
+// Required. Keys the schema does not mention are accepted as they are.
+type AttributeDefinition struct {
+	ID           uint     `gorm:"primaryKey" json:"id"`
+	CollectionID uint     `gorm:"not null;index" json:"collection_id"`
+	Key          string   `gorm:"not null" json:"key"`
+	Type         string   `gorm:"type:varchar(20);not null" json:"type"`
+	Unit         string   `gorm:"not null;default:''" json:"unit"`
+	Required     bool     `gorm:"not null;default:false" json:"required"`
+	Options      []string `gorm:"serializer:json;type:text" json:"options"`
+	Position     int      `gorm:"not null;default:0" json:"position"`
+}
+
+// ProductAttributeInput carries a text, number, boolean or list of text
+// values. When Type is left out it follows the JSON type of Value.
+type ProductAttributeInput struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+	Unit  string `json:"unit"`
+}
+
+type AttributeDefinitionInput struct {
+	Key      string   `json:"key"`
+	Type     string   `json:"type"`
+	Unit     string   `json:"unit"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options"`
+}
+
+type UpdateAttributeSchemaInput struct {
+	Attributes []AttributeDefinitionInput `json:"attributes" binding:"required"`
+}
@@ -0,0 +1,52 @@
+package models
+
+const (
+	BulkOperationAdjustPrice      = "adjust_price"
+	BulkOperationMoveToCollection = "move_to_collection"
+	BulkOperationSetStatus        = "set_status"
+	BulkOperationDelete           = "delete"
+)
+
+const (
+	PriceAdjustmentPercent = "percent"
+	PriceAdjustmentFixed   = "fixed"
+)
+
+// Rounding rules for adjusted prices. The "ends" rules pick the nearest
+// price with those cents, e.g. 41.37 becomes 40.90 or 40.99.
+const (
+	PriceRoundingCents  = "cents"
+	PriceRoundingWhole  = "whole"
+	PriceRoundingEnds90 = "ends_90"
+	PriceRoundingEnds99 = "ends_99"
+)
+
+// BulkProductInput selects products either by IDs or by Filter, never both.
+// Preview runs the operation and reports the outcome without saving it.
+type BulkProductInput struct {
+	IDs          []uint               `json:"ids"`
+	Filter       *BulkProductFilter   `json:"filter"`
+	Operation    string               `json:"operation" binding:"required"`
+	Price        *BulkPriceAdjustment `json:"price"`
+	CollectionID *uint                `json:"collection_id"`
+	Status       string               `json:"status"`
+	Preview      bool                 `json:"preview"`
+}
+
+type BulkProductFilter struct {
+	CollectionID  *uint    `json:"collection_id"`
+	Uncategorized bool     `json:"uncategorized"`
+	Tags          []string `json:"tags"`
+	Status        string   `json:"status"`
+	MinPrice      *float64 `json:"min_price"`
+	MaxPrice      *float64 `json:"max_price"`
+	HasImages     *bool    `json:"has_images"`
+}
+
+// BulkPriceAdjustment raises prices by Value (a percentage or an amount);
+// negative values lower them. Variant prices are adjusted the same way.
+type BulkPriceAdjustment struct {
+	Mode     string  `json:"mode" binding:"required"`
+	Value    float64 `json:"value"`
+	Rounding string  `json:"rounding"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	ProductTypeSimple = "simple"
+	ProductTypeBundle = "bundle"
+)
+
+// BundleItem puts Quantity units of a component product into a bundle.
+// Components are simple products without variants. Component is nil when the
+// component is in the trash, which leaves the bundle unavailable.
+type BundleItem struct {
+	ID          uint     `gorm:"primaryKey" json:"id"`
+	BundleID    uint     `gorm:"not null;index" json:"bundle_id"`
+	ComponentID uint     `gorm:"not null;index" json:"component_id"`
+	Component   *Product `gorm:"foreignKey:ComponentID;constraint:OnDelete:RESTRICT" json:"component"`
+	Quantity    int      `gorm:"not null;default:1" json:"quantity"`
+	Position    int      `gorm:"not null;default:0" json:"position"`
+}
+
+type BundleItemInput struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+// BundleAvailableFor reports whether every component can supply the given
+// number of bundles. Components in the trash or not publicly visible, such as
+// drafts and scheduled or archived products, make the bundle unavailable.
+// BundleItems must be loaded with their components.
+func (p *Product) BundleAvailableFor(bundles float64) bool {
+	if len(p.BundleItems) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, item := range p.BundleItems {
+		component := item.Component
+		if component == nil || !component.PubliclyVisible(now) {
+			return false
+		}
+		if component.TrackStock && !component.AllowBackorder && float64(component.StockQuantity) < bundles*float64(item.Quantity) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,18 @@
+package models
+
+// DefaultCloneSuffix is appended to the name of a clone when the request does
+// not say otherwise; send an empty suffix to keep the name unchanged.
+const DefaultCloneSuffix = " (cópia)"
+
+type CloneProductInput struct {
+	NameSuffix *string              `json:"name_suffix"`
+	Price      *BulkPriceAdjustment `json:"price"`
+}
+
+// CloneCollectionInput names the new collection with NameSuffix; the copied
+// products keep their names unless ProductNameSuffix is set.
+type CloneCollectionInput struct {
+	NameSuffix        *string              `json:"name_suffix"`
+	ProductNameSuffix string               `json:"product_name_suffix"`
+	Price             *BulkPriceAdjustment `json:"price"`
+}
@@ -1,15 +1,20 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Collection struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	OwnerID     uint      `gorm:"not null;index" json:"owner_id"`
-	ShareToken  *string   `gorm:"uniqueIndex" json:"share_token"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description string    `gorm:"not null;default:''" json:"description"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	OwnerID     uint           `gorm:"not null;index" json:"owner_id"`
+	ShareToken  *string        `gorm:"uniqueIndex" json:"share_token"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `gorm:"not null;default:''" json:"description"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
 
 type CreateCollectionInput struct {
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+const (
+	ImportStatusUploaded  = "uploaded"
+	ImportStatusQueued    = "queued"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// Fields a spreadsheet column can be mapped to. Collections and tags hold
+// several names separated by ";".
+const (
+	ImportFieldSKU            = "sku"
+	ImportFieldName           = "name"
+	ImportFieldDescription    = "description"
+	ImportFieldPrice          = "price"
+	ImportFieldCompareAtPrice = "compare_at_price"
+	ImportFieldStatus         = "status"
+	ImportFieldStockQuantity  = "stock_quantity"
+	ImportFieldCollections    = "collections"
+	ImportFieldTags           = "tags"
+)
+
+var ImportFields = []string{
+	ImportFieldSKU,
+	ImportFieldName,
+	ImportFieldDescription,
+	ImportFieldPrice,
+	ImportFieldCompareAtPrice,
+	ImportFieldStatus,
+	ImportFieldStockQuantity,
+	ImportFieldCollections,
+	ImportFieldTags,
+}
+
+// ImportJob tracks one uploaded spreadsheet from column mapping through the
+// background run. A dry run validates every row without writing anything and
+// can be followed by a real run of the same file.
+type ImportJob struct {
+	ID            uint              `gorm:"primaryKey" json:"id"`
+	OwnerID       uint              `gorm:"not null;index" json:"owner_id"`
+	FileName      string            `gorm:"not null" json:"file_name"`
+	StoredPath    string            `gorm:"not null" json:"-"`
+	Status        string            `gorm:"type:varchar(20);not null;index" json:"status"`
+	DryRun        bool              `gorm:"not null;default:false" json:"dry_run"`
+	Headers       []string          `gorm:"serializer:json" json:"headers"`
+	Mapping       map[string]string `gorm:"serializer:json" json:"mapping"`
+	TotalRows     int               `gorm:"not null;default:0" json:"total_rows"`
+	ProcessedRows int               `gorm:"not null;default:0" json:"processed_rows"`
+	CreatedCount  int               `gorm:"not null;default:0" json:"created_count"`
+	UpdatedCount  int               `gorm:"not null;default:0" json:"updated_count"`
+	FailedCount   int               `gorm:"not null;default:0" json:"failed_count"`
+	RowErrors     []ImportRowError  `gorm:"serializer:json" json:"row_errors"`
+	Error         string            `gorm:"not null;default:''" json:"error"`
+	StartedAt     *time.Time        `json:"started_at"`
+	FinishedAt    *time.Time        `json:"finished_at"`
+	CreatedAt     time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ImportRowError reports a problem with one spreadsheet row. Row is the line
+// number as shown by spreadsheet programs, header included.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// RunImportInput maps each import field to a spreadsheet header.
+type RunImportInput struct {
+	Mapping map[string]string `json:"mapping" binding:"required"`
+	DryRun  bool              `json:"dry_run"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	StockReasonInitial    = "initial"
+	StockReasonRestock    = "restock"
+	StockReasonSale       = "sale"
+	StockReasonReturn     = "return"
+	StockReasonLoss       = "loss"
+	StockReasonAdjustment = "adjustment"
+)
+
+var StockReasons = []string{
+	StockReasonInitial,
+	StockReasonRestock,
+	StockReasonSale,
+	StockReasonReturn,
+	StockReasonLoss,
+	StockReasonAdjustment,
+}
+
+// StockMovement is one entry of the stock ledger. Rows are only ever
+// inserted, so the ledger explains every change to a stock level.
+type StockMovement struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	OwnerID       uint      `gorm:"not null;index" json:"owner_id"`
+	ProductID     uint      `gorm:"not null;index" json:"product_id"`
+	VariantID     *uint     `gorm:"index" json:"variant_id"`
+	UserID        uint      `gorm:"not null" json:"user_id"`
+	Delta         int       `gorm:"not null" json:"delta"`
+	QuantityAfter int       `gorm:"not null" json:"quantity_after"`
+	Reason        string    `gorm:"not null" json:"reason"`
+	Note          string    `gorm:"not null;default:''" json:"note"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type StockAdjustmentInput struct {
+	VariantID *uint  `json:"variant_id"`
+	Delta     *int   `json:"delta"`
+	Quantity  *int   `json:"quantity"`
+	Reason    string `json:"reason" binding:"required"`
+	Note      string `json:"note"`
+}
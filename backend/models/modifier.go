@@ -0,0 +1,57 @@
+package models
+
+// ModifierGroup is a choice added to a product, such as "Escolha o molho" or
+// "Adicionais". Shoppers pick between MinSelect and MaxSelect options in
+// total, counting each option as many times as it is chosen.
+type ModifierGroup struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	ProductID uint             `gorm:"not null;index" json:"product_id"`
+	Name      string           `gorm:"not null" json:"name"`
+	MinSelect int              `gorm:"not null;default:0" json:"min_select"`
+	MaxSelect int              `gorm:"not null;default:1" json:"max_select"`
+	Position  int              `gorm:"not null;default:0" json:"position"`
+	Options   []ModifierOption `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"options"`
+}
+
+// ModifierOption adds Price to each unit of the product every time it is
+// chosen, up to MaxQuantity times.
+type ModifierOption struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	GroupID     uint    `gorm:"not null;index" json:"group_id"`
+	Name        string  `gorm:"not null" json:"name"`
+	Price       float64 `gorm:"not null;default:0" json:"price"`
+	MaxQuantity int     `gorm:"not null;default:1" json:"max_quantity"`
+	Available   bool    `gorm:"not null;default:true" json:"available"`
+	Position    int     `gorm:"not null;default:0" json:"position"`
+}
+
+// ModifierGroupInput leaves MaxSelect at 1 when it is zero.
+type ModifierGroupInput struct {
+	Name      string                `json:"name"`
+	MinSelect int                   `json:"min_select"`
+	MaxSelect int                   `json:"max_select"`
+	Options   []ModifierOptionInput `json:"options"`
+}
+
+// ModifierOptionInput leaves MaxQuantity at 1 when it is zero and Available
+// at true when it is nil.
+type ModifierOptionInput struct {
+	Name        string  `json:"name"`
+	Price       float64 `json:"price"`
+	MaxQuantity int     `json:"max_quantity"`
+	Available   *bool   `json:"available"`
+}
+
+// ModifierSelectionInput chooses an option Quantity times; zero means once.
+type ModifierSelectionInput struct {
+	OptionID uint `json:"option_id"`
+	Quantity int  `json:"quantity"`
+}
+
+// ProductPriceInput prices one line of a product with its modifiers.
+// Quantity defaults to 1.
+type ProductPriceInput struct {
+	VariantID *uint                    `json:"variant_id"`
+	Quantity  float64                  `json:"quantity"`
+	Modifiers []ModifierSelectionInput `json:"modifiers"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+const NotificationLowStock = "low_stock"
+
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Type      string     `gorm:"not null" json:"type"`
+	Message   string     `gorm:"not null" json:"message"`
+	ProductID *uint      `json:"product_id"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+const (
+	SaleUnitUnit  = "unit"
+	SaleUnitDozen = "dozen"
+	SaleUnitKg    = "kg"
+)
+
+var SaleUnits = []string{SaleUnitUnit, SaleUnitDozen, SaleUnitKg}
+
+// PriceTier is a wholesale price: from MinQuantity sale units on, every unit
+// costs UnitPrice, unless the product's current price is already lower.
+type PriceTier struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	ProductID   uint    `gorm:"not null;index" json:"product_id"`
+	MinQuantity float64 `gorm:"not null" json:"min_quantity"`
+	UnitPrice   float64 `gorm:"not null" json:"unit_price"`
+}
+
+type PriceTierInput struct {
+	MinQuantity float64 `json:"min_quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+}
+
+// QuoteInput is a cart to price. VariantID is required for products with
+// variants, and Modifiers must satisfy the product's modifier groups.
+// CartID is an id the client keeps for the cart, such as a UUID; without it
+// the quote does not count towards suggestions.
+type QuoteInput struct {
+	Items  []QuoteItemInput `json:"items" binding:"required"`
+	CartID string           `json:"cart_id"`
+}
+
+type QuoteItemInput struct {
+	ProductID uint                     `json:"product_id"`
+	VariantID *uint                    `json:"variant_id"`
+	Quantity  float64                  `json:"quantity"`
+	Modifiers []ModifierSelectionInput `json:"modifiers"`
+}
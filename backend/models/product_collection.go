@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ProductCollection places a product in a collection. A product can appear in
+// any number of collections and still counts once against the plan limit.
+//
+// Position and Pinned hold the owner's manual order inside the collection.
+// Pinned products come first, then positioned ones, then the rest newest
+// first; a collection that was never reordered is simply newest first.
+type ProductCollection struct {
+	ProductID    uint      `gorm:"primaryKey" json:"product_id"`
+	CollectionID uint      `gorm:"primaryKey;index" json:"collection_id"`
+	Position     *int      `json:"position"`
+	Pinned       bool      `gorm:"not null;default:false" json:"pinned"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// ReorderCollectionInput lists products in their new order. Products left
+// out keep their current relative order after the listed ones.
+type ReorderCollectionInput struct {
+	ProductIDs []uint `json:"product_ids" binding:"required"`
+}
+
+type PinProductInput struct {
+	Pinned *bool `json:"pinned" binding:"required"`
+}
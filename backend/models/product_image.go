@@ -1,11 +1,76 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// ProductImage is one picture of a product. The image with the lowest
+// Position is the cover, mirrored in Product.ImageURL.
+//
+// Renditions are smaller copies of ImageURL in JPEG and WebP; Srcset lists
+// them per format, ready for the srcset attribute of an img or source tag.
+// Images uploaded before renditions existed have none until the backfill
+// reaches them.
 type ProductImage struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	ProductID uint      `gorm:"not null;index" json:"product_id"`
-	ImageURL  string    `gorm:"not null" json:"image_url"`
-	Position  int       `gorm:"not null;default:0" json:"position"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID         uint             `gorm:"primaryKey" json:"id"`
+	ProductID  uint             `gorm:"not null;index" json:"product_id"`
+	ImageURL   string           `gorm:"not null" json:"image_url"`
+	Renditions []ImageRendition `gorm:"serializer:json;type:text" json:"renditions"`
+	Srcset     ImageSrcset      `gorm:"-" json:"srcset"`
+	Position   int              `gorm:"not null;default:0" json:"position"`
+	AltText    string           `gorm:"not null;default:''" json:"alt_text"`
+	Caption    string           `gorm:"not null;default:''" json:"caption"`
+	CreatedAt  time.Time        `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type ImageRendition struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type ImageSrcset struct {
+	JPEG string `json:"jpeg"`
+	WebP string `json:"webp"`
+}
+
+func (i *ProductImage) AfterFind(tx *gorm.DB) error {
+	i.RefreshSrcset()
+	return nil
+}
+
+// RefreshSrcset builds Srcset from Renditions, listing each width once.
+func (i *ProductImage) RefreshSrcset() {
+	i.Srcset = ImageSrcset{JPEG: srcsetFor(i.Renditions, "jpeg"), WebP: srcsetFor(i.Renditions, "webp")}
+}
+
+func srcsetFor(renditions []ImageRendition, format string) string {
+	var candidates []string
+	var widths []int
+	for _, rendition := range renditions {
+		if rendition.Format != format || slices.Contains(widths, rendition.Width) {
+			continue
+		}
+		widths = append(widths, rendition.Width)
+		candidates = append(candidates, fmt.Sprintf("%s %dw", rendition.URL, rendition.Width))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// ReorderImagesInput lists images in their new order. Images left out keep
+// their current relative order after the listed ones.
+type ReorderImagesInput struct {
+	ImageIDs []uint `json:"image_ids" binding:"required"`
+}
+
+type UpdateProductImageInput struct {
+	AltText *string `json:"alt_text"`
+	Caption *string `json:"caption"`
 }
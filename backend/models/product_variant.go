@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ProductOption is an axis such as "Tamanho" or "Cor" with the values a
+// shopper can pick from.
+type ProductOption struct {
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	ProductID uint     `gorm:"not null;index" json:"product_id"`
+	Name      string   `gorm:"not null" json:"name"`
+	Values    []string `gorm:"serializer:json;type:text;not null" json:"values"`
+	Position  int      `gorm:"not null;default:0" json:"position"`
+}
+
+// ProductVariant is one combination of option values, keyed by option name.
+type ProductVariant struct {
+	ID            uint              `gorm:"primaryKey" json:"id"`
+	ProductID     uint              `gorm:"not null;index" json:"product_id"`
+	SKU           *string           `json:"sku"`
+	Options       map[string]string `gorm:"serializer:json;type:text;not null" json:"options"`
+	Price         *float64          `json:"price"`
+	ImageID       *uint             `json:"image_id"`
+	Available     bool              `gorm:"not null" json:"available"`
+	StockQuantity int               `gorm:"not null;default:0" json:"stock_quantity"`
+	InStock       bool              `gorm:"-" json:"in_stock"`
+	Position      int               `gorm:"not null;default:0" json:"position"`
+	CreatedAt     time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type ProductOptionInput struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductVariantInput struct {
+	ID         *uint             `json:"id"`
+	SKU        *string           `json:"sku"`
+	Options    map[string]string `json:"options"`
+	Price      *float64          `json:"price"`
+	ImageID    *uint             `json:"image_id"`
+	ImageIndex *int              `json:"image_index"`
+	Available  *bool             `json:"available"`
+	// StockQuantity is the new level; a change is recorded in the stock
+	// ledger as an adjustment.
+	StockQuantity *int `json:"stock_quantity"`
+}
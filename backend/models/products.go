@@ -1,33 +1,287 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"strconv"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+const (
+	ProductStatusDraft     = "draft"
+	ProductStatusPublished = "published"
+	ProductStatusArchived  = "archived"
+)
+
+var ProductStatuses = []string{ProductStatusDraft, ProductStatusPublished, ProductStatusArchived}
+
+// A published product with a future PublishAt stays hidden from public
+// endpoints until that time; archived and trashed products do not count
+// against plan limits.
+//
+// When TrackStock is set, StockQuantity holds the level of products without
+// variants; products with variants keep their stock on each variant.
+//
+// SalePrice replaces Price between SaleStartsAt and SaleEndsAt; either bound
+// may be open. EffectivePrice, OnSale and OriginalPrice are derived on load.
+//
+// Quantities are counted in SaleUnit; orders need at least MinOrderQuantity
+// and larger ones may reach a cheaper PriceTier.
+//
+// A bundle sells its BundleItems together at its own Price and keeps no
+// stock of its own.
 type Product struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	OwnerID      uint           `gorm:"not null;index" json:"owner_id"`
-	CollectionID *uint          `gorm:"index" json:"collection_id"`
-	Name         string         `gorm:"not null" json:"name"`
-	Description  string         `gorm:"not null" json:"description"`
-	Price        float64        `gorm:"not null" json:"price"`
-	ImageURL     *string        `json:"image_url"`
-	Images       []ProductImage `gorm:"foreignKey:ProductID" json:"images"`
-	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                uint                `gorm:"primaryKey" json:"id"`
+	OwnerID           uint                `gorm:"not null;index;uniqueIndex:idx_products_owner_sku_live,where:deleted_at IS NULL" json:"owner_id"`
+	SKU               *string             `gorm:"uniqueIndex:idx_products_owner_sku_live,where:deleted_at IS NULL" json:"sku"`
+	Name              string              `gorm:"not null" json:"name"`
+	Description       string              `gorm:"not null" json:"description"`
+	Price             float64             `gorm:"not null" json:"price"`
+	Status            string              `gorm:"type:varchar(20);not null;default:published;index" json:"status"`
+	Type              string              `gorm:"type:varchar(20);not null;default:simple" json:"type"`
+	PublishAt         *time.Time          `json:"publish_at"`
+	ImageURL          *string             `json:"image_url"`
+	CompareAtPrice    *float64            `json:"compare_at_price"`
+	SalePrice         *float64            `json:"sale_price"`
+	SaleStartsAt      *time.Time          `json:"sale_starts_at"`
+	SaleEndsAt        *time.Time          `json:"sale_ends_at"`
+	EffectivePrice    float64             `gorm:"-" json:"effective_price"`
+	OnSale            bool                `gorm:"-" json:"on_sale"`
+	OriginalPrice     *float64            `gorm:"-" json:"original_price"`
+	TrackStock        bool                `gorm:"not null;default:false" json:"track_stock"`
+	StockQuantity     int                 `gorm:"not null;default:0" json:"stock_quantity"`
+	AllowBackorder    bool                `gorm:"not null;default:false" json:"allow_backorder"`
+	LowStockThreshold *int                `json:"low_stock_threshold"`
+	InStock           bool                `gorm:"-" json:"in_stock"`
+	MinOrderQuantity  float64             `gorm:"not null;default:1" json:"min_order_quantity"`
+	SaleUnit          string              `gorm:"type:varchar(20);not null;default:unit" json:"sale_unit"`
+	PriceTiers        []PriceTier         `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"price_tiers"`
+	BundleItems       []BundleItem        `gorm:"foreignKey:BundleID;constraint:OnDelete:CASCADE" json:"bundle_items"`
+	BundleIncomplete  bool                `gorm:"-" json:"bundle_incomplete"`
+	Images            []ProductImage      `gorm:"foreignKey:ProductID" json:"images"`
+	Options           []ProductOption     `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"options"`
+	Variants          []ProductVariant    `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"variants"`
+	Attributes        []ProductAttribute  `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"attributes"`
+	ModifierGroups    []ModifierGroup     `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"modifier_groups"`
+	CollectionLinks   []ProductCollection `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"-"`
+	CollectionIDs     []uint              `gorm:"-" json:"collection_ids"`
+	Tags              []Tag               `gorm:"many2many:product_tags;constraint:OnDelete:CASCADE" json:"tags"`
+	CreatedAt         time.Time           `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time           `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt         gorm.DeletedAt      `gorm:"index" json:"deleted_at"`
+}
+
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	p.CollectionIDs = make([]uint, len(p.CollectionLinks))
+	for i, link := range p.CollectionLinks {
+		p.CollectionIDs[i] = link.CollectionID
+	}
+	p.RefreshAvailability()
+	p.RefreshPricing(time.Now())
+	return nil
+}
+
+// SaleActive reports whether the scheduled sale applies at the given time.
+func (p *Product) SaleActive(at time.Time) bool {
+	if p.SalePrice == nil {
+		return false
+	}
+	if p.SaleStartsAt != nil && at.Before(*p.SaleStartsAt) {
+		return false
+	}
+	if p.SaleEndsAt != nil && !at.Before(*p.SaleEndsAt) {
+		return false
+	}
+	return true
+}
+
+// PubliclyVisible reports whether shared catalogs show the product at the
+// given time: it is published and its scheduled publishing time has passed.
+func (p *Product) PubliclyVisible(at time.Time) bool {
+	return p.Status == ProductStatusPublished && (p.PublishAt == nil || !p.PublishAt.After(at))
+}
+
+// RefreshPricing derives the price charged at the given time and the higher
+// price to show struck through next to it, if any.
+func (p *Product) RefreshPricing(at time.Time) {
+	p.EffectivePrice = p.Price
+	p.OriginalPrice = nil
+	if p.SaleActive(at) {
+		p.EffectivePrice = *p.SalePrice
+		if p.Price > p.EffectivePrice {
+			original := p.Price
+			p.OriginalPrice = &original
+		}
+	}
+	if p.CompareAtPrice != nil && *p.CompareAtPrice > p.EffectivePrice {
+		original := *p.CompareAtPrice
+		p.OriginalPrice = &original
+	}
+	p.OnSale = p.OriginalPrice != nil
+}
+
+// RefreshAvailability derives InStock for the product and its loaded
+// variants from the stock settings. Bundles are in stock when their
+// components are.
+func (p *Product) RefreshAvailability() {
+	if p.Type == ProductTypeBundle {
+		p.InStock = p.BundleAvailableFor(1)
+		p.BundleIncomplete = false
+		for _, item := range p.BundleItems {
+			if item.Component == nil {
+				p.BundleIncomplete = true
+			}
+		}
+		return
+	}
+
+	if len(p.Variants) == 0 {
+		p.InStock = p.hasStock(p.StockQuantity)
+		return
+	}
+
+	p.InStock = false
+	for i := range p.Variants {
+		variant := &p.Variants[i]
+		variant.InStock = variant.Available && p.hasStock(variant.StockQuantity)
+		if variant.InStock {
+			p.InStock = true
+		}
+	}
 }
 
+func (p *Product) hasStock(quantity int) bool {
+	return !p.TrackStock || p.AllowBackorder || quantity > 0
+}
+
+// CollectionID is the single-collection form kept for older clients;
+// CollectionIDs takes precedence when both are sent.
 type CreateProductInput struct {
-	Name         string  `json:"name" form:"name" binding:"required"`
-	Description  string  `json:"description" form:"description" binding:"required"`
-	Price        float64 `json:"price" form:"price" binding:"required"`
-	CollectionID *uint   `json:"collection_id" form:"collection_id"`
-	ImageURL     *string `json:"image_url" form:"image_url"`
+	Name          string   `json:"name" form:"name" binding:"required"`
+	Description   string   `json:"description" form:"description" binding:"required"`
+	Price         float64  `json:"price" form:"price" binding:"required"`
+	CollectionID  *uint    `json:"collection_id" form:"collection_id"`
+	CollectionIDs []uint   `json:"collection_ids" form:"collection_ids"`
+	Tags          []string `json:"tags" form:"tags"`
+	SKU           *string  `json:"sku" form:"sku"`
+	ImageURL      *string  `json:"image_url" form:"image_url"`
+
+	// Status defaults to published.
+	Status    string  `json:"status" form:"status"`
+	PublishAt *string `json:"publish_at" form:"publish_at"`
+
+	// Sale bounds and PublishAt are RFC 3339 timestamps or local
+	// "2006-01-02T15:04" / "2006-01-02" values read in the owner's timezone.
+	// A compare_at_price of 0 leaves the product without one.
+	CompareAtPrice *float64 `json:"compare_at_price" form:"compare_at_price"`
+	SalePrice      *float64 `json:"sale_price" form:"sale_price"`
+	SaleStartsAt   *string  `json:"sale_starts_at" form:"sale_starts_at"`
+	SaleEndsAt     *string  `json:"sale_ends_at" form:"sale_ends_at"`
+
+	TrackStock        bool `json:"track_stock" form:"track_stock"`
+	StockQuantity     int  `json:"stock_quantity" form:"stock_quantity"`
+	AllowBackorder    bool `json:"allow_backorder" form:"allow_backorder"`
+	LowStockThreshold *int `json:"low_stock_threshold" form:"low_stock_threshold"`
+
+	// Type defaults to simple; bundles list their contents in BundleItems,
+	// which arrive like Options.
+	Type        string            `json:"type" form:"type"`
+	BundleItems []BundleItemInput `json:"bundle_items" form:"-"`
+
+	// SaleUnit defaults to unit and MinOrderQuantity to 1. PriceTiers
+	// arrive like Options.
+	SaleUnit         string           `json:"sale_unit" form:"sale_unit"`
+	MinOrderQuantity *float64         `json:"min_order_quantity" form:"min_order_quantity"`
+	PriceTiers       []PriceTierInput `json:"price_tiers" form:"-"`
+
+	// Options and Variants arrive as JSON arrays, or as JSON-encoded
+	// "options" and "variants" fields in multipart requests.
+	Options  []ProductOptionInput  `json:"options" form:"-"`
+	Variants []ProductVariantInput `json:"variants" form:"-"`
+
+	// Attributes arrive like Options, as a JSON-encoded "attributes" field
+	// in multipart requests.
+	Attributes []ProductAttributeInput `json:"attributes" form:"-"`
+
+	// ModifierGroups arrive like Options.
+	ModifierGroups []ModifierGroupInput `json:"modifier_groups" form:"-"`
+}
+
+// NullablePrice is an optional price of an update request that tells an
+// explicit null, or an empty multipart field, apart from a field that was
+// not sent. Value is nil for null.
+type NullablePrice struct {
+	Sent  bool
+	Value *float64
+}
+
+func (p *NullablePrice) UnmarshalJSON(data []byte) error {
+	p.Sent = true
+	p.Value = nil
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &p.Value)
+}
+
+func (p *NullablePrice) UnmarshalParam(param string) error {
+	p.Sent = true
+	p.Value = nil
+	if param == "" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return err
+	}
+	p.Value = &value
+	return nil
 }
 
 type UpdateProductInput struct {
-	Name            *string  `json:"name" form:"name"`
-	Description     *string  `json:"description" form:"description"`
-	Price           *float64 `json:"price" form:"price"`
-	CollectionID    *uint    `json:"collection_id" form:"collection_id"`
-	ImageURL        *string  `json:"image_url" form:"image_url"`
-	DeleteImageIDs  []uint   `json:"delete_image_ids" form:"delete_image_ids"`
+	Name           *string  `json:"name" form:"name"`
+	Description    *string  `json:"description" form:"description"`
+	Price          *float64 `json:"price" form:"price"`
+	CollectionID   *uint    `json:"collection_id" form:"collection_id"`
+	CollectionIDs  []uint   `json:"collection_ids" form:"collection_ids"`
+	Tags           []string `json:"tags" form:"tags"`
+	SKU            *string  `json:"sku" form:"sku"`
+	ImageURL       *string  `json:"image_url" form:"image_url"`
+	DeleteImageIDs []uint   `json:"delete_image_ids" form:"delete_image_ids"`
+
+	Status    *string `json:"status" form:"status"`
+	PublishAt *string `json:"publish_at" form:"publish_at"`
+
+	// A null or empty price, a compare_at_price of 0 or less, a negative
+	// sale_price or an empty date clears the field.
+	CompareAtPrice NullablePrice `json:"compare_at_price" form:"compare_at_price"`
+	SalePrice      NullablePrice `json:"sale_price" form:"sale_price"`
+	SaleStartsAt   *string       `json:"sale_starts_at" form:"sale_starts_at"`
+	SaleEndsAt     *string       `json:"sale_ends_at" form:"sale_ends_at"`
+
+	TrackStock        *bool  `json:"track_stock" form:"track_stock"`
+	StockQuantity     *int   `json:"stock_quantity" form:"stock_quantity"`
+	AllowBackorder    *bool  `json:"allow_backorder" form:"allow_backorder"`
+	LowStockThreshold *int   `json:"low_stock_threshold" form:"low_stock_threshold"`
+	StockNote         string `json:"stock_note" form:"stock_note"`
+
+	// A nil BundleItems leaves the contents of a bundle untouched.
+	BundleItems *[]BundleItemInput `json:"bundle_items" form:"-"`
+
+	// A nil PriceTiers leaves the tiers untouched; a present one replaces them.
+	SaleUnit         *string           `json:"sale_unit" form:"sale_unit"`
+	MinOrderQuantity *float64          `json:"min_order_quantity" form:"min_order_quantity"`
+	PriceTiers       *[]PriceTierInput `json:"price_tiers" form:"-"`
+
+	// A nil Options or Variants leaves the set untouched; a present one
+	// replaces it entirely.
+	Options  *[]ProductOptionInput  `json:"options" form:"-"`
+	Variants *[]ProductVariantInput `json:"variants" form:"-"`
+
+	// A nil Attributes leaves them untouched; a present one replaces them.
+	Attributes *[]ProductAttributeInput `json:"attributes" form:"-"`
+
+	// A nil ModifierGroups leaves them untouched; a present one replaces them.
+	ModifierGroups *[]ModifierGroupInput `json:"modifier_groups" form:"-"`
 }
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// RelatedProduct is a suggestion the owner picked by hand for a product,
+// shown before any automatic one.
+type RelatedProduct struct {
+	ProductID uint     `gorm:"primaryKey" json:"product_id"`
+	RelatedID uint     `gorm:"primaryKey;index" json:"related_id"`
+	Position  int      `gorm:"not null;default:0" json:"position"`
+	Product   *Product `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"-"`
+	Related   *Product `gorm:"foreignKey:RelatedID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ProductAffinity counts the quoted carts that held both products. Quotes
+// are the closest thing to orders the catalog sees, but anyone with the link
+// can send one, so each cart counts once and suggestions rank the counts
+// below the owner's picks and shared tags. Every pair is stored in both
+// directions.
+type ProductAffinity struct {
+	ProductID uint     `gorm:"primaryKey" json:"product_id"`
+	RelatedID uint     `gorm:"primaryKey;index" json:"related_id"`
+	Count     int      `gorm:"not null;default:0" json:"count"`
+	Product   *Product `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"-"`
+	Related   *Product `gorm:"foreignKey:RelatedID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// QuotedCart remembers a cart whose products were counted, so quoting it
+// again after an edit or a replay changes nothing. ClientHash identifies the
+// sender without storing the address itself.
+type QuotedCart struct {
+	CollectionID uint      `gorm:"primaryKey"`
+	CartID       string    `gorm:"primaryKey;type:varchar(64)"`
+	ClientHash   string    `gorm:"type:varchar(64);not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;index"`
+}
+
+type UpdateRelatedProductsInput struct {
+	ProductIDs []uint `json:"product_ids" binding:"required"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+const (
+	RevisionEntityProduct    = "product"
+	RevisionEntityCollection = "collection"
+)
+
+// Revision records one change to a product or collection. Snapshot holds
+// every tracked field as it was after the change, so a product can be put
+// back to any revision; Changes lists only the fields that differ from the
+// state before it, which is enough to rebuild that state too. RestoredFromID
+// is set when the change was a rollback.
+type Revision struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	OwnerID        uint           `gorm:"not null;index" json:"owner_id"`
+	UserID         uint           `gorm:"not null" json:"user_id"`
+	EntityType     string         `gorm:"type:varchar(20);not null;index:idx_revisions_entity" json:"entity_type"`
+	EntityID       uint           `gorm:"not null;index:idx_revisions_entity" json:"entity_id"`
+	RestoredFromID *uint          `json:"restored_from_id"`
+	Changes        []FieldChange  `gorm:"serializer:json" json:"changes"`
+	Snapshot       map[string]any `gorm:"serializer:json" json:"snapshot"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// ProductSnapshot is the part of a product that revisions track. Stock is
+// left out because the stock ledger already explains it, and so are images,
+// options and variants.
+type ProductSnapshot struct {
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	Price             float64    `json:"price"`
+	SKU               *string    `json:"sku"`
+	Status            string     `json:"status"`
+	PublishAt         *time.Time `json:"publish_at"`
+	CompareAtPrice    *float64   `json:"compare_at_price"`
+	SalePrice         *float64   `json:"sale_price"`
+	SaleStartsAt      *time.Time `json:"sale_starts_at"`
+	SaleEndsAt        *time.Time `json:"sale_ends_at"`
+	TrackStock        bool       `json:"track_stock"`
+	AllowBackorder    bool       `json:"allow_backorder"`
+	LowStockThreshold *int       `json:"low_stock_threshold"`
+	SaleUnit          string     `json:"sale_unit"`
+	MinOrderQuantity  float64    `json:"min_order_quantity"`
+	CollectionIDs     []uint     `json:"collection_ids"`
+	Tags              []string   `json:"tags"`
+}
+
+type CollectionSnapshot struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
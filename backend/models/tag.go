@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Tag names are unique per owner regardless of case, through the
+// idx_tags_owner_lower_name index created in database.migrateTagNames.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OwnerID   uint      `gorm:"not null;index" json:"owner_id"`
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
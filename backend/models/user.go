@@ -2,12 +2,16 @@ package models
 
 import "time"
 
+// DefaultTimezone is the store timezone used until the owner picks another.
+const DefaultTimezone = "America/Sao_Paulo"
+
 type User struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Username  string    `gorm:"unique;not null" json:"username"`
 	Email     string    `gorm:"unique;not null" json:"email"`
 	Password  string    `gorm:"not null" json:"-"`
 	Number    string    `gorm:"unique;not null" json:"number"`
+	Timezone  string    `gorm:"not null;default:America/Sao_Paulo" json:"timezone"`
 	PlanID    uint      `gorm:"not null;default:1" json:"plan_id"`
 	Plan      *Plan     `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
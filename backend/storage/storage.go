@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"strings"
+)
+
+// Storage keeps uploaded files under flat keys such as "1700000000_0.jpg".
+// URL is where clients fetch a file from.
+type Storage interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete succeeds when the file does not exist.
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Uploads is where product images are stored, chosen by Configure.
+var Uploads Storage
+
+// Imports keeps uploaded spreadsheets until their import has run, so that any
+// replica can run it. It is never served: the local driver uses its own
+// directory, IMPORTS_DIR (default "imports"), and S3 shares the bucket of
+// Uploads, where spreadsheets get unguessable keys.
+var Imports Storage
+
+var ErrNotFound = errors.New("file not found")
+
+// Configure sets Uploads from the environment. STORAGE_DRIVER is "local",
+// the default, or "s3".
+func Configure() {
+	storage, err := FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure storage: ", err)
+	}
+	Uploads = storage
+
+	if _, ok := storage.(*S3); ok {
+		Imports = storage
+		return
+	}
+	dir := os.Getenv("IMPORTS_DIR")
+	if dir == "" {
+		dir = "imports"
+	}
+	if Imports, err = NewLocal(dir, ""); err != nil {
+		log.Fatal("Failed to configure storage: ", err)
+	}
+}
+
+// FromEnv builds the storage described by the environment:
+//
+//	STORAGE_DRIVER=local  UPLOADS_DIR (default "uploads"), served at /uploads
+//	STORAGE_DRIVER=s3     S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID,
+//	                      S3_SECRET_ACCESS_KEY, S3_PUBLIC_URL, S3_PATH_STYLE
+func FromEnv() (Storage, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("UPLOADS_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocal(dir, "/uploads")
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") != "false",
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+// Key returns the key of a stored file from its URL.
+func Key(url string) string {
+	return path.Base(url)
+}
+
+// Copy duplicates a file inside one storage.
+func Copy(ctx context.Context, storage Storage, sourceKey, targetKey string) error {
+	body, err := storage.Get(ctx, sourceKey)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, targetKey, body, ContentType(targetKey))
+}
+
+// ContentType guesses the type of a file from the extension of its key.
+func ContentType(key string) string {
+	if contentType := mime.TypeByExtension(strings.ToLower(path.Ext(key))); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func validKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
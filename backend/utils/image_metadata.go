@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+)
+
+// Uploads are re-encoded without their metadata, so EXIF data such as GPS
+// coordinates, camera details and thumbnails never reaches the stored files.
+// The orientation is applied to the pixels and the ICC colour profile is
+// carried over unless IMAGE_KEEP_COLOR_PROFILE is "false".
+var keepColorProfile = os.Getenv("IMAGE_KEEP_COLOR_PROFILE") != "false"
+
+const (
+	exifOrientationTag = 0x0112
+	maxColorProfile    = 1 << 20
+	// An APP2 segment holds at most 65533 bytes, 14 of them taken by the
+	// ICC_PROFILE header.
+	iccChunkSize = 65519
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// Orientation returns the EXIF orientation of a JPEG or PNG, from 1 to 8,
+// or 1 when the file has none.
+func Orientation(data []byte) int {
+	var exif []byte
+	switch DetectImageFormat(data) {
+	case "jpeg":
+		exif = jpegSegment(data, 0xE1, exifHeader)
+	case "png":
+		exif = pngChunk(data, "eXIf")
+	}
+	if orientation := tiffOrientation(exif); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	return 1
+}
+
+// ColorProfile returns the ICC profile embedded in a JPEG or PNG, or nil
+// when there is none or profiles are not kept.
+func ColorProfile(data []byte) []byte {
+	if !keepColorProfile {
+		return nil
+	}
+	var profile []byte
+	switch DetectImageFormat(data) {
+	case "jpeg":
+		profile = jpegColorProfile(data)
+	case "png":
+		profile = pngColorProfile(data)
+	}
+	if len(profile) > maxColorProfile {
+		return nil
+	}
+	return profile
+}
+
+// jpegSegments calls fn with the marker and payload of every segment before
+// the image data, until fn returns false.
+func jpegSegments(data []byte, fn func(marker byte, payload []byte) bool) {
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			pos += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return
+		}
+		if !fn(marker, data[pos+4:pos+2+length]) {
+			return
+		}
+		pos += 2 + length
+	}
+}
+
+func jpegSegment(data []byte, marker byte, header []byte) []byte {
+	var found []byte
+	jpegSegments(data, func(m byte, payload []byte) bool {
+		if m == marker && bytes.HasPrefix(payload, header) {
+			found = payload[len(header):]
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// jpegColorProfile joins the APP2 chunks a profile is split into.
+func jpegColorProfile(data []byte) []byte {
+	chunks := map[byte][]byte{}
+	var count byte
+	jpegSegments(data, func(marker byte, payload []byte) bool {
+		if marker == 0xE2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2 {
+			count = payload[len(iccHeader)+1]
+			chunks[payload[len(iccHeader)]] = payload[len(iccHeader)+2:]
+		}
+		return true
+	})
+	if count == 0 || len(chunks) != int(count) {
+		return nil
+	}
+	var profile []byte
+	for seq := byte(1); seq <= count; seq++ {
+		chunk, ok := chunks[seq]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+func pngChunk(data []byte, name string) []byte {
+	for pos := 8; pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil
+		}
+		if string(data[pos+4:pos+8]) == name {
+			return data[pos+8 : pos+8+length]
+		}
+		pos += 12 + length
+	}
+	return nil
+}
+
+// pngColorProfile inflates the profile of an iCCP chunk, which follows the
+// profile name and the compression method.
+func pngColorProfile(data []byte) []byte {
+	chunk := pngChunk(data, "iCCP")
+	end := bytes.IndexByte(chunk, 0)
+	if end < 0 || end+2 > len(chunk) || chunk[end+1] != 0 {
+		return nil
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(chunk[end+2:]))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	profile, err := io.ReadAll(io.LimitReader(reader, maxColorProfile+1))
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// The value of a single SHORT sits in the entry itself.
+		if order.Uint16(tiff[entry:]) == exifOrientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// applyOrientation turns img upright according to an EXIF orientation.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	// source maps a pixel of the upright image back to the stored one.
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, h - 1 - x },
+		7: func(x, y int) (int, int) { return w - 1 - y, h - 1 - x },
+		8: func(x, y int) (int, int) { return w - 1 - y, x },
+	}[orientation]
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			sx, sy := source(x, y)
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+// embedJPEGColorProfile inserts profile as APP2 segments right after the
+// start of a JPEG written by image/jpeg.
+func embedJPEGColorProfile(data, profile []byte) []byte {
+	if len(profile) == 0 || len(data) < 2 {
+		return data
+	}
+	count := (len(profile) + iccChunkSize - 1) / iccChunkSize
+	var buf bytes.Buffer
+	buf.Write(data[:2])
+	for i := 0; i < count; i++ {
+		chunk := profile[i*iccChunkSize : min((i+1)*iccChunkSize, len(profile))]
+		buf.Write([]byte{0xFF, 0xE2})
+		binary.Write(&buf, binary.BigEndian, uint16(2+len(iccHeader)+2+len(chunk)))
+		buf.Write(iccHeader)
+		buf.Write([]byte{byte(i + 1), byte(count)})
+		buf.Write(chunk)
+	}
+	buf.Write(data[2:])
+	return buf.Bytes()
+}
+
+// embedPNGColorProfile inserts profile as an iCCP chunk after the IHDR
+// chunk of a PNG written by image/png.
+func embedPNGColorProfile(data, profile []byte) []byte {
+	const ihdrEnd = 8 + 12 + 13
+	if len(profile) == 0 || len(data) < ihdrEnd {
+		return data
+	}
+	var body bytes.Buffer
+	body.WriteString("icc\x00\x00")
+	writer := zlib.NewWriter(&body)
+	writer.Write(profile)
+	writer.Close()
+
+	var buf bytes.Buffer
+	buf.Write(data[:ihdrEnd])
+	binary.Write(&buf, binary.BigEndian, uint32(body.Len()))
+	chunk := append([]byte("iCCP"), body.Bytes()...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	buf.Write(data[ihdrEnd:])
+	return buf.Bytes()
+}
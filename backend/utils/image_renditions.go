@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	RenditionFormatJPEG = "jpeg"
+	RenditionFormatWebP = "webp"
+
+	renditionQuality = 75
+)
+
+// RenditionSpec bounds the width of one rendition. Images narrower than
+// MaxWidth keep their own width.
+type RenditionSpec struct {
+	Name     string
+	MaxWidth int
+}
+
+var RenditionSpecs = []RenditionSpec{
+	{Name: "thumb", MaxWidth: 200},
+	{Name: "card", MaxWidth: 600},
+	{Name: "full", MaxWidth: 1600},
+}
+
+var renditionFormats = map[string]string{
+	RenditionFormatJPEG: ".jpg",
+	RenditionFormatWebP: ".webp",
+}
+
+type Rendition struct {
+	Name   string
+	Format string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// WebP is encoded by the cwebp tool from libwebp, since the standard library
+// has no WebP encoder. Without it only JPEG renditions are made.
+var cwebpPath = sync.OnceValue(func() string {
+	path, err := exec.LookPath("cwebp")
+	if err != nil {
+		log.Printf("cwebp not found, image renditions will be JPEG only")
+	}
+	return path
+})
+
+// RenditionKey is the file name of a rendition of the image stored as key:
+// the image's own name with the rendition name appended.
+func RenditionKey(key, name, format string) string {
+	base := strings.TrimSuffix(key, filepath.Ext(key))
+	return base + "_" + name + renditionFormats[format]
+}
+
+// RenditionKeys lists every rendition file an image stored as key may have.
+func RenditionKeys(key string) []string {
+	keys := make([]string, 0, len(RenditionSpecs)*len(renditionFormats))
+	for _, spec := range RenditionSpecs {
+		for _, format := range []string{RenditionFormatJPEG, RenditionFormatWebP} {
+			keys = append(keys, RenditionKey(key, spec.Name, format))
+		}
+	}
+	return keys
+}
+
+// CreateRenditions encodes a JPEG and, when possible, a WebP copy of img for
+// every RenditionSpec, embedding the colour profile when there is one.
+func CreateRenditions(img image.Image, profile []byte) ([]Rendition, error) {
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	renditions := make([]Rendition, 0, len(RenditionSpecs)*len(renditionFormats))
+	for _, spec := range RenditionSpecs {
+		resized := resizeToWidth(rgba, min(spec.MaxWidth, rgba.Bounds().Dx()))
+		width, height := resized.Bounds().Dx(), resized.Bounds().Dy()
+
+		data, err := EncodeJPEG(resized, profile)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, Rendition{Name: spec.Name, Format: RenditionFormatJPEG, Width: width, Height: height, Data: data})
+
+		if cwebpPath() == "" {
+			continue
+		}
+		if data, err = encodeWebP(resized, profile); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, Rendition{Name: spec.Name, Format: RenditionFormatWebP, Width: width, Height: height, Data: data})
+	}
+	return renditions, nil
+}
+
+// encodeWebP hands cwebp a lossless PNG so the image is compressed only once.
+// The colour profile travels in the PNG, and cwebp keeps nothing else.
+func encodeWebP(img image.Image, profile []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "rendition-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input, output := filepath.Join(dir, "in.png"), filepath.Join(dir, "out.webp")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(input, embedPNGColorProfile(buf.Bytes(), profile), 0o600); err != nil {
+		return nil, err
+	}
+
+	message, err := exec.Command(cwebpPath(), "-quiet", "-q", strconv.Itoa(renditionQuality), "-metadata", "icc", input, "-o", output).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("cwebp: %w: %s", err, strings.TrimSpace(string(message)))
+	}
+	return os.ReadFile(output)
+}
+
+// resizeToWidth scales img down to width, keeping its aspect ratio. Each
+// target pixel averages the source pixels it covers.
+func resizeToWidth(img *image.RGBA, width int) *image.RGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width >= srcW {
+		return img
+	}
+	height := max(1, srcH*width/srcW)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcH/height, max((y+1)*srcH/height, y*srcH/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcW/width, max((x+1)*srcW/width, x*srcW/width+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[sy*img.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
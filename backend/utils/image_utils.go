@@ -1,37 +1,123 @@
 package utils
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 	"image/jpeg"
-	_ "image/png"
-	"mime/multipart"
-	"os"
+	"image/png"
+	"io"
 )
 
-func SaveCompressedImage(fileHeader *multipart.FileHeader, destPath string) error {
-	src, err := fileHeader.Open()
-	if err != nil {
-		return err
+const (
+	// MaxImageBytes is the largest upload accepted, in bytes.
+	MaxImageBytes = 10 << 20
+	// MaxImageDimension bounds the width and the height of an upload.
+	MaxImageDimension = 8000
+	// MaxImagePixels bounds the decoded size of an upload, about 160 MB as
+	// RGBA, so a small file cannot claim a huge canvas.
+	MaxImagePixels = 40_000_000
+)
+
+// ImageError reports why an upload was rejected. Its message can be shown
+// to the client.
+type ImageError struct {
+	message string
+}
+
+func (e *ImageError) Error() string {
+	return e.message
+}
+
+func imageError(format string, args ...any) error {
+	return &ImageError{message: fmt.Sprintf(format, args...)}
+}
+
+// imageSignatures is the allowlist of upload types, recognized by their
+// leading bytes rather than by the client's Content-Type or file name.
+var imageSignatures = []struct {
+	format    string
+	signature []byte
+}{
+	{format: "jpeg", signature: []byte{0xFF, 0xD8, 0xFF}},
+	{format: "png", signature: []byte("\x89PNG\r\n\x1a\n")},
+}
+
+// DetectImageFormat returns "jpeg" or "png" from the first bytes of a file,
+// or "" for anything else.
+func DetectImageFormat(data []byte) string {
+	for _, known := range imageSignatures {
+		if bytes.HasPrefix(data, known.signature) {
+			return known.format
+		}
 	}
-	defer src.Close()
+	return ""
+}
 
-	img, _, err := image.Decode(src)
+// ReadImage reads an upload, failing once it goes past MaxImageBytes.
+func ReadImage(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageBytes+1))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(data) > MaxImageBytes {
+		return nil, imageTooLarge()
+	}
+	return data, nil
+}
+
+func imageTooLarge() error {
+	return imageError("image must be at most %d MB", MaxImageBytes>>20)
+}
+
+// DecodeImage decodes a JPEG or PNG after checking its type and dimensions,
+// turned upright according to its EXIF orientation. The header is read
+// first, so oversized images are rejected before any pixel memory is
+// allocated.
+func DecodeImage(data []byte) (image.Image, error) {
+	if len(data) > MaxImageBytes {
+		return nil, imageTooLarge()
+	}
+	format := DetectImageFormat(data)
+	if format == "" {
+		return nil, imageError("image must be a JPEG or PNG file")
+	}
+
+	var config image.Config
+	var err error
+	if format == "jpeg" {
+		config, err = jpeg.DecodeConfig(bytes.NewReader(data))
+	} else {
+		config, err = png.DecodeConfig(bytes.NewReader(data))
 	}
-	out, err := os.Create(destPath)
 	if err != nil {
-		return err
+		return nil, imageError("image could not be read")
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, imageError("image has no pixels")
+	}
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension || config.Width*config.Height > MaxImagePixels {
+		return nil, imageError("image must be at most %dx%d pixels and %d megapixels", MaxImageDimension, MaxImageDimension, MaxImagePixels/1_000_000)
 	}
-	defer out.Close()
 
-	return jpeg.Encode(out, img, &jpeg.Options{Quality: 75})
+	var img image.Image
+	if format == "jpeg" {
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	} else {
+		img, err = png.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, imageError("image could not be read")
+	}
+	return applyOrientation(img, Orientation(data)), nil
 }
 
-func IsImageFile(fileHeader *multipart.FileHeader) bool {
-    contentType := fileHeader.Header.Get("Content-Type")
-    if contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/jpg" {
-        return true
-    }
-    return false
+// EncodeJPEG compresses an image the way uploads are stored, with the colour
+// profile, if any, as its only metadata.
+func EncodeJPEG(img image.Image, profile []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return embedJPEGColorProfile(buf.Bytes(), profile), nil
 }
@@ -0,0 +1,492 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxZipEntrySize bounds how much a single XLSX part may decompress to.
+	maxZipEntrySize = 64 << 20
+	// maxSpreadsheetColumns is the column limit of Excel itself.
+	maxSpreadsheetColumns = 16384
+)
+
+var (
+	ErrUnsupportedSpreadsheet = errors.New("unsupported spreadsheet format")
+	ErrTooManyRows            = errors.New("spreadsheet has too many rows")
+)
+
+// ReadSpreadsheet returns the rows of a CSV file or of the first worksheet of
+// an XLSX workbook, telling them apart by the extension of name. Trailing
+// empty rows are dropped. Reading stops with ErrTooManyRows as soon as a row
+// past maxRows has content.
+func ReadSpreadsheet(name string, data []byte, maxRows int) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		rows, err = readCSV(data, maxRows)
+	case ".xlsx":
+		rows, err = readXLSX(data, maxRows)
+	default:
+		return nil, ErrUnsupportedSpreadsheet
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for len(rows) > 0 && isBlankRow(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readCSV accepts both comma and semicolon separated files, the latter being
+// what spreadsheet programs export under Brazilian locales.
+func readCSV(data []byte, maxRows int) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	firstLine, _, _ := bufio.NewReader(bytes.NewReader(data)).ReadLine()
+	reader := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) >= maxRows && !isBlankRow(record) {
+			return nil, ErrTooManyRows
+		}
+		rows = append(rows, record)
+	}
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelationshipID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var builder strings.Builder
+	for _, run := range t.Runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxRow struct {
+	Index int `xml:"r,attr"`
+	Cells []struct {
+		Ref    string   `xml:"r,attr"`
+		Type   string   `xml:"t,attr"`
+		Value  string   `xml:"v"`
+		Inline xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+func readXLSX(data []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetFile, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet %s not found", sheetPath)
+	}
+	reader, err := openZipEntry(sheetFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// Rows are decoded one at a time so their indexes, which come from the
+	// file, are checked before any room is made for them.
+	var rows [][]string
+	decoder := xml.NewDecoder(reader)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, isStart := token.(xml.StartElement)
+		if !isStart || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+
+		cells, err := xlsxRowCells(row, shared)
+		if err != nil {
+			return nil, err
+		}
+		rowIndex := max(row.Index-1, len(rows))
+		if rowIndex >= maxRows {
+			if isBlankRow(cells) {
+				continue
+			}
+			return nil, ErrTooManyRows
+		}
+		for len(rows) < rowIndex {
+			rows = append(rows, nil)
+		}
+		rows = append(rows, cells)
+	}
+}
+
+func xlsxRowCells(row xlsxRow, shared xlsxSharedStrings) ([]string, error) {
+	var cells []string
+	for i, cell := range row.Cells {
+		column := i
+		if cell.Ref != "" {
+			if parsed, err := columnIndex(cell.Ref); err == nil {
+				column = parsed
+			}
+		}
+		if column >= maxSpreadsheetColumns {
+			return nil, fmt.Errorf("cell %s is past the last column", cell.Ref)
+		}
+		for len(cells) <= column {
+			cells = append(cells, "")
+		}
+
+		switch cell.Type {
+		case "s":
+			index, err := strconv.Atoi(cell.Value)
+			if err != nil || index < 0 || index >= len(shared.Items) {
+				return nil, fmt.Errorf("invalid shared string in cell %s", cell.Ref)
+			}
+			cells[column] = shared.Items[index].String()
+		case "inlineStr":
+			cells[column] = cell.Inline.String()
+		default:
+			cells[column] = cell.Value
+		}
+	}
+	return cells, nil
+}
+
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	workbookFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("workbook not found")
+	}
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(workbookFile, &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("workbook has no worksheets")
+	}
+
+	var rels xlsxRelationships
+	if file, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		if err := decodeZipXML(file, &rels); err != nil {
+			return "", err
+		}
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RelationshipID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func decodeZipXML(file *zip.File, target any) error {
+	reader, err := openZipEntry(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return xml.NewDecoder(reader).Decode(target)
+}
+
+// openZipEntry refuses entries that claim to decompress past maxZipEntrySize.
+// archive/zip fails reads that go beyond the claimed size, so a zip bomb
+// cannot lie its way through.
+func openZipEntry(file *zip.File) (io.ReadCloser, error) {
+	if file.UncompressedSize64 > maxZipEntrySize {
+		return nil, fmt.Errorf("%s is too large", file.Name)
+	}
+	return file.Open()
+}
+
+// columnIndex turns a cell reference such as "C12" into a zero-based column.
+func columnIndex(ref string) (int, error) {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A') + 1
+		letters++
+	}
+	if letters == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return column - 1, nil
+}
+
+// SpreadsheetWriter writes rows straight to the underlying writer so large
+// exports never sit in memory. Cells may be strings, numbers or nil.
+type SpreadsheetWriter interface {
+	WriteRow(cells []any) error
+	Close() error
+}
+
+func NewSpreadsheetWriter(format string, w io.Writer) (SpreadsheetWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(w)
+	case "xlsx":
+		return newXLSXWriter(w)
+	default:
+		return nil, ErrUnsupportedSpreadsheet
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+// newCSVWriter starts the file with a byte order mark so spreadsheet programs
+// read it as UTF-8.
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: csv.NewWriter(w)}, nil
+}
+
+func (cw *csvWriter) WriteRow(cells []any) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		if text, ok := cell.(string); ok {
+			record[i] = EscapeFormula(text)
+		} else {
+			record[i] = formatCell(cell)
+		}
+	}
+	return cw.writer.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+func formatCell(cell any) string {
+	switch value := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(value)
+	case uint:
+		return strconv.FormatUint(uint64(value), 10)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// formulaTriggers are the first characters that make spreadsheet programs
+// read a cell as a formula.
+const formulaTriggers = "=+-@\t\r"
+
+// EscapeFormula prefixes text that a spreadsheet program would evaluate with
+// an apostrophe, so names and descriptions exported to CSV stay plain text.
+// XLSX cells are typed as strings and need no escaping. Text
+// that already starts with an apostrophe before such a character gets one
+// more, so UnescapeFormula always gives the original back.
+func EscapeFormula(text string) string {
+	if needsFormulaEscape(text) {
+		return "'" + text
+	}
+	return text
+}
+
+// UnescapeFormula undoes EscapeFormula for cells imported from CSV.
+func UnescapeFormula(text string) string {
+	if escaped, ok := strings.CutPrefix(text, "'"); ok && needsFormulaEscape(escaped) {
+		return escaped
+	}
+	return text
+}
+
+func needsFormulaEscape(text string) bool {
+	for strings.HasPrefix(text, "'") {
+		text = text[1:]
+	}
+	return text != "" && strings.ContainsRune(formulaTriggers, rune(text[0]))
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Produtos" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter writes a single-sheet workbook with inline strings, so rows can
+// be streamed without building a shared string table first.
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	row     int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, xlsxSheetStart); err != nil {
+		return nil, err
+	}
+	return &xlsxWriter{archive: archive, sheet: sheet}, nil
+}
+
+func (xw *xlsxWriter) WriteRow(cells []any) error {
+	xw.row++
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, xw.row)
+	for i, cell := range cells {
+		ref := columnName(i) + strconv.Itoa(xw.row)
+		switch value := cell.(type) {
+		case nil:
+			continue
+		case float64, int, uint:
+			fmt.Fprintf(&buf, `<c r="%s"><v>%s</v></c>`, ref, formatCell(value))
+		default:
+			fmt.Fprintf(&buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&buf, []byte(formatCell(value))); err != nil {
+				return err
+			}
+			buf.WriteString(`</t></is></c>`)
+		}
+	}
+	buf.WriteString(`</row>`)
+	_, err := xw.sheet.Write(buf.Bytes())
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := io.WriteString(xw.sheet, xlsxSheetEnd); err != nil {
+		return err
+	}
+	return xw.archive.Close()
+}
+
+// columnName turns a zero-based column index into its letters, e.g. 27 → "AB".
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
@@ -1,5 +1,5 @@
 import type { HttpClient } from '@/api/httpClient'
-import type { CreateProductInput, Product, UpdateProductInput } from '@/api/types'
+import type { CreateProductInput, Product, ProductPage, UpdateProductInput } from '@/api/types'
 
 export interface ProductsService {
   getMine(): Promise<Product[]>
@@ -17,7 +17,9 @@ export class ApiProductsService implements ProductsService {
   }
 
   getMine(): Promise<Product[]> {
-    return this.http.request<Product[]>('GET', '/protected/products', { auth: true })
+    return this.fetchAllPages((cursor) =>
+      this.http.request<ProductPage>('GET', '/protected/products', { auth: true, query: { limit: 200, cursor } }),
+    )
   }
 
   create(input: CreateProductInput): Promise<Product> {
@@ -70,11 +72,26 @@ export class ApiProductsService implements ProductsService {
   }
 
   getPublic(filters?: { ownerId?: number; collectionId?: number }): Promise<Product[]> {
-    return this.http.request<Product[]>('GET', '/public/products', {
-      query: {
-        owner_id: filters?.ownerId,
-        collection_id: filters?.collectionId,
-      },
-    })
+    return this.fetchAllPages((cursor) =>
+      this.http.request<ProductPage>('GET', '/public/products', {
+        query: {
+          owner_id: filters?.ownerId,
+          collection_id: filters?.collectionId,
+          limit: 200,
+          cursor,
+        },
+      }),
+    )
+  }
+
+  private async fetchAllPages(fetchPage: (cursor?: string) => Promise<ProductPage>): Promise<Product[]> {
+    const products: Product[] = []
+    let cursor: string | undefined
+    do {
+      const page = await fetchPage(cursor)
+      products.push(...page.products)
+      cursor = page.next_cursor ?? undefined
+    } while (cursor)
+    return products
   }
 }
@@ -26,19 +26,44 @@ export type ProductImage = {
   created_at: string
 }
 
+export type Tag = {
+  id: number
+  owner_id: number
+  name: string
+  created_at: string
+}
+
+export type ProductStatus = 'draft' | 'published' | 'archived'
+
 export type Product = {
   id: number
   owner_id: number
-  collection_id: number | null
+  collection_ids: number[]
   name: string
   description: string
   price: number
+  status: ProductStatus
+  publish_at?: string | null
+  compare_at_price?: number | null
+  sale_price?: number | null
+  sale_starts_at?: string | null
+  sale_ends_at?: string | null
+  effective_price: number
+  on_sale: boolean
+  original_price?: number | null
   image_url?: string | null
   images?: ProductImage[]
+  tags?: Tag[]
   created_at: string
   updated_at: string
 }
 
+export type ProductPage = {
+  products: Product[]
+  total: number
+  next_cursor: string | null
+}
+
 export type CreateProductInput = {
   name: string
   description: string
@@ -82,8 +82,9 @@ export function useCatalogs() {
   const catalogs = useMemo<CatalogCard[]>(() => {
     const countByCollectionId = new Map<number, number>()
     for (const p of products) {
-      if (p.collection_id === null) continue
-      countByCollectionId.set(p.collection_id, (countByCollectionId.get(p.collection_id) ?? 0) + 1)
+      for (const collectionId of p.collection_ids ?? []) {
+        countByCollectionId.set(collectionId, (countByCollectionId.get(collectionId) ?? 0) + 1)
+      }
     }
 
     return collections.map((c) => ({
@@ -71,7 +71,7 @@ export default function CollectionPage({ onLogout, user }: CollectionPageProps)
 
       const found = cols.find((c) => c.id === collectionId) ?? null
       setCollection(found)
-      setProducts(prods.filter((p) => p.collection_id === collectionId))
+      setProducts(prods.filter((p) => p.collection_ids?.includes(collectionId)))
       setCollectionName(found?.name ?? '')
       setCollectionDescription(found?.description ?? '')
 
@@ -185,7 +185,6 @@ export default function CollectionPage({ onLogout, user }: CollectionPageProps)
         name: trimmedName, 
         description: trimmedDesc, 
         price: parsedPrice, 
-        collection_id: collectionId, 
         images: editProductNewImages.length > 0 ? editProductNewImages : undefined,
         delete_image_ids: editProductDeleteImageIds.length > 0 ? editProductDeleteImageIds : undefined
       })
@@ -358,7 +357,7 @@ export default function CollectionPage({ onLogout, user }: CollectionPageProps)
                         <label className="flex items-center gap-2 px-3 py-2 bg-gray-50 border border-gray-300 rounded-lg cursor-pointer hover:bg-gray-100">
                           <ImageIcon className="w-4 h-4 text-gray-500" />
                           <span className="text-sm text-gray-600">Adicionar imagens</span>
-                          <input type="file" accept="image/*" multiple onChange={(e) => handleAddImagesToEdit(e.target.files)} className="hidden" />
+                          <input type="file" accept="image/jpeg,image/png" multiple onChange={(e) => handleAddImagesToEdit(e.target.files)} className="hidden" />
                         </label>
                         <div className="flex gap-2">
                           <Button size="sm" onClick={() => void saveProductEdit(p.id)} isLoading={isUpdatingProduct}><Save className="w-4 h-4 mr-1" />Salvar</Button>
@@ -469,7 +468,7 @@ export default function CollectionPage({ onLogout, user }: CollectionPageProps)
                           <span className="text-sm text-gray-600 truncate">
                             {images.length > 0 ? `${images.length} imagem(ns)` : 'Adicionar imagens'}
                           </span>
-                          <input type="file" accept="image/*" multiple onChange={(e) => handleAddImagesToCreate(e.target.files)} className="hidden" />
+                          <input type="file" accept="image/jpeg,image/png" multiple onChange={(e) => handleAddImagesToCreate(e.target.files)} className="hidden" />
                         </label>
                         <Button type="submit" isLoading={isSaving} className="w-full">
                           Adicionar
@@ -108,7 +108,7 @@ export default function PublicCatalogPage() {
     return items
   }, [cart, products])
 
-  const total = useMemo(() => cartItems.reduce((acc, i) => acc + i.product.price * i.qty, 0), [cartItems])
+  const total = useMemo(() => cartItems.reduce((acc, i) => acc + i.product.effective_price * i.qty, 0), [cartItems])
   const totalItems = useMemo(() => cartItems.reduce((acc, i) => acc + i.qty, 0), [cartItems])
 
   function handleFinishOrder() {
@@ -120,7 +120,7 @@ export default function PublicCatalogPage() {
     message += `📦 *Itens do pedido:*\n`
     
     cartItems.forEach(({ product, qty }) => {
-      message += `• ${product.name} - Qtd: ${qty} - ${formatPrice(product.price * qty)}\n`
+      message += `• ${product.name} - Qtd: ${qty} - ${formatPrice(product.effective_price * qty)}\n`
     })
     
     message += `\n💰 *Total: ${formatPrice(total)}*`
@@ -276,7 +276,12 @@ export default function PublicCatalogPage() {
                         <p className="text-sm text-gray-500 line-clamp-2 mb-3">{p.description}</p>
 
                         <div className="flex items-center justify-between">
-                          <span className="text-lg font-bold text-blue-600">{formatPrice(p.price)}</span>
+                          <div className="flex flex-col">
+                            {p.on_sale && p.original_price != null && (
+                              <span className="text-xs text-gray-400 line-through">{formatPrice(p.original_price)}</span>
+                            )}
+                            <span className="text-lg font-bold text-blue-600">{formatPrice(p.effective_price)}</span>
+                          </div>
                           <Button
                             size="sm"
                             onClick={(e) => { e.stopPropagation(); addToCart(p.id) }}
@@ -347,7 +352,7 @@ export default function PublicCatalogPage() {
                               })()}
                               <div className="flex-1 min-w-0">
                                 <p className="font-medium text-gray-900 text-sm truncate">{product.name}</p>
-                                <p className="text-xs text-gray-500">{formatPrice(product.price)}</p>
+                                <p className="text-xs text-gray-500">{formatPrice(product.effective_price)}</p>
                               </div>
                               <div className="flex items-center gap-1">
                                 <motion.button 
@@ -485,7 +490,12 @@ export default function PublicCatalogPage() {
                     <p className="text-xs font-semibold uppercase tracking-wide text-blue-600">Produto</p>
                     <h3 className="text-2xl font-bold text-gray-900 leading-tight">{selectedProduct.name}</h3>
                   </div>
-                  <span className="text-2xl font-extrabold text-blue-700 whitespace-nowrap">{formatPrice(selectedProduct.price)}</span>
+                  <div className="flex flex-col items-end">
+                    {selectedProduct.on_sale && selectedProduct.original_price != null && (
+                      <span className="text-sm text-gray-400 line-through">{formatPrice(selectedProduct.original_price)}</span>
+                    )}
+                    <span className="text-2xl font-extrabold text-blue-700 whitespace-nowrap">{formatPrice(selectedProduct.effective_price)}</span>
+                  </div>
                 </div>
                 <p className="text-gray-600 text-base leading-relaxed">{selectedProduct.description}</p>
 